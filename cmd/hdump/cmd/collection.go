@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var collectionOutput string
+
+var collectionCmd = &cobra.Command{
+	Use:   "collection <objectId>",
+	Short: "Export entries of a collection as CSV",
+	Long: `Write the logical content of an ArrayList, LinkedList, ArrayDeque, HashMap, LinkedHashMap,
+ConcurrentHashMap, TreeMap, HashSet or another supported JDK collection as CSV with keys and values.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		objectID, err := strconv.ParseInt(args[0], 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid object ID %s: %v\n", args[0], err)
+			return
+		}
+		out := os.Stdout
+		if collectionOutput != "" {
+			f, err := os.Create(collectionOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", collectionOutput, err)
+				return
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := hprof.ExportCollection(hprof.ID(objectID), out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting collection: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	collectionCmd.Flags().StringVarP(&collectionOutput, "output", "o", "", "file to write CSV to, standard output by default")
+	rootCmd.AddCommand(collectionCmd)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var hierarchyCmd = &cobra.Command{
+	Use:   "hierarchy <className>",
+	Short: "Show superclasses and subclasses of a class",
+	Long: `Print the superclass chain with the field layout of every level, all loaded subclasses
+and instance counts and sizes of the class including its subclasses, e.g. java.util.AbstractMap.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hprof.PrintClassHierarchy(args[0]).Print()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hierarchyCmd)
+}
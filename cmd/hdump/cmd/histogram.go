@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var (
+	histogramBy    string
+	histogramDepth int
+	histogramLimit int
+)
+
+var histogramCmd = &cobra.Command{
+	Use:   "histogram",
+	Short: "Aggregate objects by package or module",
+	Long: `Print object count, shallow and retained size grouped by Java package prefix
+of the given depth or by JPMS module of the object's class.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		switch histogramBy {
+		case "package":
+			hprof.PrintPackageHistogram(histogramDepth, histogramLimit).Print()
+		case "module":
+			hprof.PrintModuleHistogram(histogramLimit).Print()
+		default:
+			fmt.Fprintf(os.Stderr, "Invalid grouping %q, expected package or module\n", histogramBy)
+		}
+	},
+}
+
+func init() {
+	histogramCmd.Flags().StringVar(&histogramBy, "by", "package", "grouping: package or module")
+	histogramCmd.Flags().IntVar(&histogramDepth, "depth", 2, "number of package name components, 0 for whole packages")
+	histogramCmd.Flags().IntVar(&histogramLimit, "limit", 50, "number of groups to print")
+	rootCmd.AddCommand(histogramCmd)
+}
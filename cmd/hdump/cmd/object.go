@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var (
+	objectOffset int
+	objectLimit  int
+)
+
+var objectCmd = &cobra.Command{
+	Use:   "object <objectId>",
+	Short: "Inspect a single object",
+	Long:  `Print the class, shallow and retained size and decoded fields of an object, or a page of elements of an array.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		objectID, err := strconv.ParseInt(args[0], 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid object ID %s: %v\n", args[0], err)
+			return
+		}
+		hprof.PrintObject(hprof.ID(objectID), objectOffset, objectLimit).Print()
+	},
+}
+
+func init() {
+	objectCmd.Flags().IntVar(&objectOffset, "offset", 0, "index of the first array element or collection entry to print")
+	objectCmd.Flags().IntVar(&objectLimit, "limit", 20, "number of array elements or collection entries to print")
+	rootCmd.AddCommand(objectCmd)
+}
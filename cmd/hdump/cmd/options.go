@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var (
+	graphOptions hprof.GraphOptions
+	sizeModel    string
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&graphOptions.IgnoreWeakReferences, "ignore-weak", false,
+		"ignore referents of weak, soft and phantom references in paths, dominators and retained sizes")
+	rootCmd.PersistentFlags().BoolVar(&graphOptions.ExcludeUnreachable, "exclude-unreachable", false,
+		"leave out objects not reachable from GC roots in all analyses")
+	rootCmd.PersistentFlags().StringVar(&sizeModel, "size-model", hprof.AutoSizeModel,
+		"object layout used for shallow sizes: "+strings.Join(hprof.SizeModelNames(), ", "))
+	cobra.OnInitialize(func() {
+		hprof.SetGraphOptions(graphOptions)
+		if err := hprof.SetSizeModel(sizeModel); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var (
+	pathCount       int
+	pathExcludeWeak bool
+)
+
+var pathToRootsCmd = &cobra.Command{
+	Use:   "path-to-roots <objectId>",
+	Short: "Show reference chains from GC roots to an object",
+	Long:  `Find the shortest reference chains from any GC root to the given object of the parsed heap dump.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		objectID, err := strconv.ParseInt(args[0], 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid object ID %s: %v\n", args[0], err)
+			return
+		}
+		hprof.PrintPathsToRoots(hprof.ID(objectID), pathCount, pathExcludeWeak).Print()
+	},
+}
+
+func init() {
+	pathToRootsCmd.Flags().IntVarP(&pathCount, "count", "k", 1, "number of shortest paths to print")
+	pathToRootsCmd.Flags().BoolVar(&pathExcludeWeak, "exclude-weak", false, "ignore weak, soft and phantom references")
+	rootCmd.AddCommand(pathToRootsCmd)
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var referrersLimit int
+
+var referrersCmd = &cobra.Command{
+	Use:   "referrers <objectId>",
+	Short: "Show objects referring to an object",
+	Long:  `List every object, static field, array slot and GC root referring to the given object, grouped by referring class.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		objectID, err := strconv.ParseInt(args[0], 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid object ID %s: %v\n", args[0], err)
+			return
+		}
+		hprof.PrintReferrers(hprof.ID(objectID), referrersLimit).Print()
+	},
+}
+
+func init() {
+	referrersCmd.Flags().IntVar(&referrersLimit, "limit", 100, "number of references to print")
+	rootCmd.AddCommand(referrersCmd)
+}
@@ -41,13 +41,32 @@ type command struct {
 var commands = []command{
 		{1, "Print size classes", "Enter max count of classes to print: " ,hprof.PrintSizeClasses},
 		{2, "Print count instances", "Enter max count of instances to print: ", hprof.PrintCountInstances},
-		{3, "Print object loaders info", "Enter max count of loaders to print: ", hprof.PrintObjectLoadersInfo},
-		{4, "Print full class size", "Enter max count of classes to print: ", hprof.PrintFullClassSize},
+		{3, "Print class loader tree", "Enter max count of classes per loader to print: ", hprof.PrintObjectLoadersInfo},
+		{4, "Print retained class size", "Enter max count of classes to print: ", hprof.PrintFullClassSize},
 		{5, "Print array info", "Enter max count of arrays to print: ", hprof.PrintArrayInfo},
 		{6, "Analyze long arrays", "Enter min size of array: ", hprof.AnalyzeLongArrays},
 		{7, "Analyze HashMap overheads", "Enter max count of HashMap: ", hprof.AnalyzeHashMapOverheads},
 		{8, "Analyze array owners", "Enter min count of elements in array, witch owners need to print: ", hprof.AnalyzeArrayOwners},
 		{9, "Analyze top array owners", "Enter max count of array owners to print: ", hprof.AnalyzeTopArrayOwners},
+		{10, "Print top retained objects", "Enter max count of objects to print: ", hprof.PrintTopRetainedObjects},
+		{11, "Analyze leak suspects", "Enter min share of heap in percent: ", hprof.AnalyzeLeakSuspects},
+		{12, "Print top strings", "Enter max count of strings to print: ", hprof.PrintTopStrings},
+		{13, "Analyze duplicate strings", "Enter max count of values to print: ", hprof.AnalyzeDuplicateStrings},
+		{14, "Analyze duplicate primitive arrays", "Enter max count of groups to print: ", hprof.AnalyzeDuplicateArrays},
+		{15, "Analyze collection fill ratio", "Enter max count of owner fields to print: ", hprof.AnalyzeCollectionFillRatio},
+		{16, "Analyze empty collections", "Enter max count of owner fields to print: ", hprof.AnalyzeEmptyCollections},
+		{17, "Analyze boxed primitives", "Enter max count of collection owners to print: ", hprof.AnalyzeBoxedPrimitives},
+		{18, "Analyze class loader leaks", "Enter max count of classes and loaders to print: ", hprof.AnalyzeClassLoaderLeaks},
+		{19, "Print threads", "Enter max count of local objects per frame: ", hprof.PrintThreads},
+		{20, "Analyze finalizers and reference queues", "Enter max count of classes and queues to print: ", hprof.AnalyzeFinalizers},
+		{21, "Analyze weak, soft and phantom references", "Enter max count of referent classes to print: ", hprof.AnalyzeReferences},
+		{22, "Analyze unreachable objects", "Enter max count of classes to print: ", hprof.AnalyzeUnreachable},
+		{23, "Analyze static fields", "Enter max count of static fields to print: ", hprof.AnalyzeStaticFields},
+		{24, "Analyze direct buffers", "Enter max count of owners and buffers to print: ", hprof.AnalyzeDirectBuffers},
+		{25, "Analyze thread locals", "Enter max count of classes and entries to print: ", hprof.AnalyzeThreadLocals},
+		{26, "Print histogram by package", []string{"Enter package depth: ", "Enter max count of packages to print: "}, hprof.PrintPackageHistogram},
+		{27, "Print histogram by module", "Enter max count of modules to print: ", hprof.PrintModuleHistogram},
+		{28, "Analyze allocation sites", []string{"Enter max count of sites to print: ", "Enter sort key (0 - live bytes, 1 - allocated bytes, 2 - live instances, 3 - allocated instances): "}, hprof.AnalyzeAllocationSites},
 	}
 
 func getDiscription() string {
@@ -79,16 +98,26 @@ func dumpFile(name string) error {
 
 	for com != -1 {
 		com -= 1
-		var num int;
-		if (commands[com].prompt != nil) {
-			fmt.Print(commands[com].prompt)
+		// A command asks for one number or, with a list of prompts, for one number per prompt
+		prompts, ok := commands[com].prompt.([]string)
+		if !ok && commands[com].prompt != nil {
+			prompts = []string{commands[com].prompt.(string)}
+		}
+		nums := make([]int, 0, len(prompts))
+		for _, prompt := range prompts {
+			var num int
+			fmt.Print(prompt)
 			if _, err := fmt.Scanln(&num); err != nil {
 				return err
 			}
 			if num < 0 {
-				fmt.Println("Invalid number")
-				continue
+				break
 			}
+			nums = append(nums, num)
+		}
+		if len(nums) < len(prompts) {
+			fmt.Println("Invalid number")
+			continue
 		}
 
 		switch record.Tag {
@@ -117,7 +146,9 @@ func dumpFile(name string) error {
 			var result hprof.AnalyzeResult
 			switch f := commands[com].action.(type) {
 			case func(int) (hprof.AnalyzeResult):
-				result = f(num)
+				result = f(nums[0])
+			case func(int, int) (hprof.AnalyzeResult):
+				result = f(nums[0], nums[1])
 			case func() (hprof.AnalyzeResult):
 				result = f()
 			default:
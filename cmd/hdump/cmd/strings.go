@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var stringsLimit int
+
+var stringsCmd = &cobra.Command{
+	Use:   "strings [substring]",
+	Short: "List java.lang.String values with counts",
+	Long:  `List decoded java.lang.String values of the parsed heap dump, optionally only values containing the substring.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pattern := ""
+		if len(args) > 0 {
+			pattern = args[0]
+		}
+		hprof.PrintStrings(pattern, stringsLimit).Print()
+	},
+}
+
+func init() {
+	stringsCmd.Flags().IntVar(&stringsLimit, "limit", 50, "max count of values to print")
+	rootCmd.AddCommand(stringsCmd)
+}
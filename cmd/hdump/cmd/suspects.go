@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var suspectsThreshold int
+
+var suspectsCmd = &cobra.Command{
+	Use:   "suspects",
+	Short: "Find objects that retain a large share of the heap",
+	Long:  `Report single objects and groups of same-class objects retaining a large share of the heap, their accumulation points and paths to GC roots.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		hprof.AnalyzeLeakSuspects(suspectsThreshold).Print()
+	},
+}
+
+func init() {
+	suspectsCmd.Flags().IntVar(&suspectsThreshold, "threshold", 10, "minimal share of the heap in percent")
+	rootCmd.AddCommand(suspectsCmd)
+}
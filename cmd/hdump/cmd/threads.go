@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sreznick/heapmaster/internal/hprof"
+)
+
+var threadsLocals int
+
+var threadsCmd = &cobra.Command{
+	Use:   "threads",
+	Short: "Show threads with stacks and objects held by local variables",
+	Long: `List every thread of the parsed heap dump with its name, state and stack trace,
+and the objects held by local variables of each frame with their retained sizes.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		hprof.PrintThreads(threadsLocals).Print()
+	},
+}
+
+func init() {
+	threadsCmd.Flags().IntVar(&threadsLocals, "locals", 10, "number of local objects to print per frame")
+	rootCmd.AddCommand(threadsCmd)
+}
@@ -0,0 +1,124 @@
+package hprof
+
+import (
+	"fmt"
+)
+
+// allocationSite is a Site row with the resolved class name.
+type allocationSite struct {
+	ArrayIndicator             BasicType `gorm:"column:array_indicator"`
+	ClassName                  string    `gorm:"column:class_name"`
+	StackTraceSerialNumber     int32     `gorm:"column:stack_trace_serial"`
+	NumberOfLiveBytes          int64     `gorm:"column:live_bytes"`
+	NumberOfLiveInstances      int64     `gorm:"column:live_instances"`
+	NumberOfBytesAllocated     int64     `gorm:"column:allocated_bytes"`
+	NumberOfInstancesAllocated int64     `gorm:"column:allocated_instances"`
+}
+
+// typeName shows array sites as arrays of the class or of the primitive type.
+func (s allocationSite) typeName() string {
+	switch s.ArrayIndicator {
+	case NonArray:
+		return s.ClassName
+	case Object:
+		return s.ClassName + "[]"
+	}
+	return s.ArrayIndicator.GetName() + "[]"
+}
+
+// Keys AnalyzeAllocationSites ranks sites by.
+const (
+	SitesByLiveBytes = iota
+	SitesByAllocatedBytes
+	SitesByLiveInstances
+	SitesByAllocatedInstances
+)
+
+// siteOrders holds the name and the ORDER BY clause of every sort key, ties are broken
+// by the matching allocated or live counter.
+var siteOrders = []struct {
+	name    string
+	orderBy string
+}{
+	SitesByLiveBytes:          {"live bytes", `st."NumberOfLiveBytes" DESC, st."NumberOfBytesAllocated" DESC`},
+	SitesByAllocatedBytes:     {"allocated bytes", `st."NumberOfBytesAllocated" DESC, st."NumberOfLiveBytes" DESC`},
+	SitesByLiveInstances:      {"live instances", `st."NumberOfLiveInstances" DESC, st."NumberOfInstancesAllocated" DESC`},
+	SitesByAllocatedInstances: {"allocated instances", `st."NumberOfInstancesAllocated" DESC, st."NumberOfLiveInstances" DESC`},
+}
+
+// AnalyzeAllocationSites ranks sites of the last ALLOC_SITES record by one of the Sites* keys
+// and prints the allocating stack trace of each site. The records are written by the hprof agent
+// with heap=sites, dumps taken by jmap or HotSpotDiagnosticMXBean do not have them.
+func AnalyzeAllocationSites(max, sortKey int) (result AnalyzeResult) {
+	if sortKey < 0 || sortKey >= len(siteOrders) {
+		return AnalyzeResult{
+			Header: "\n\nAllocation sites\n",
+			Body:   []string{fmt.Sprintf("Error: unknown sort key %d, expected 0 to %d\n", sortKey, len(siteOrders)-1)},
+		}
+	}
+	order := siteOrders[sortKey]
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d allocation sites by %s\n", max, order.name),
+		Body:   make([]string, 0),
+	}
+
+	if !IsDBInitialized() {
+		result.Body = append(result.Body, "Error: Database is not initialized\n")
+		return result
+	}
+
+	// The last record describes the heap at the moment of the dump
+	var allocSites AllocSites
+	if err := GetDB().Order("\"ID\" DESC").Limit(1).Find(&allocSites).Error; err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error getting allocation sites: %v\n", err))
+		return result
+	}
+	if allocSites.ID == 0 {
+		result.Body = append(result.Body, "No allocation sites found, the dump has no ALLOC_SITES records\n")
+		return result
+	}
+	result.Body = append(result.Body, fmt.Sprintf("Live: %d bytes in %d instances, Allocated: %d bytes in %d instances\n",
+		allocSites.TotalLiveBytes, allocSites.TotalLiveInstances, allocSites.TotalBytesAllocated, allocSites.TotalInstanceAllocated))
+
+	var sites []allocationSite
+	query := fmt.Sprintf(`
+		SELECT
+			st."ArrayIndicator" as array_indicator,
+			COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || st."ClassSerialNumber"::text) as class_name,
+			st."StackTraceSerialNumber" as stack_trace_serial,
+			st."NumberOfLiveBytes" as live_bytes,
+			st."NumberOfLiveInstances" as live_instances,
+			st."NumberOfBytesAllocated" as allocated_bytes,
+			st."NumberOfInstancesAllocated" as allocated_instances
+		FROM "Site" st
+		LEFT JOIN "LoadClass" lc ON st."ClassSerialNumber" = lc."ClassSerialNumber"
+		LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
+		WHERE st."AllocSitesID" = ?
+		ORDER BY %s
+		LIMIT ?
+	`, order.orderBy)
+	if err := GetDB().Raw(query, allocSites.ID, max).Scan(&sites).Error; err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error getting sites: %v\n", err))
+		return result
+	}
+
+	for i, site := range sites {
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s, Live: %d bytes in %d instances (%.1f%%), Allocated: %d bytes in %d instances\n",
+			i+1, site.typeName(), site.NumberOfLiveBytes, site.NumberOfLiveInstances,
+			percentOf(site.NumberOfLiveBytes, int64(allocSites.TotalLiveBytes)),
+			site.NumberOfBytesAllocated, site.NumberOfInstancesAllocated))
+
+		frames, err := loadStackTrace(site.StackTraceSerialNumber)
+		if err != nil {
+			result.Body = append(result.Body, fmt.Sprintf("   Error: %v\n", err))
+			continue
+		}
+		if len(frames) == 0 {
+			result.Body = append(result.Body, fmt.Sprintf("   Stack trace %d is not in the dump\n", site.StackTraceSerialNumber))
+		}
+		for _, frame := range frames {
+			result.Body = append(result.Body, fmt.Sprintf("      %s\n", frame))
+		}
+	}
+	return result
+}
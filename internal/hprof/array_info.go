@@ -11,7 +11,7 @@ type ArrayInfo struct {
 	Kind        string
 	ObjectID    ID
 	NumElements int32
-	TotalSize   int32
+	TotalSize   int64
 }
 
 // AnalyzeLongArrays
@@ -28,6 +28,12 @@ func AnalyzeLongArrays(minElements int) (result AnalyzeResult) {
 	}
 
 	var arrays []ArrayInfo
+	model := currentSizeModel()
+	reachable, err := reachableFilter()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
 
 	// Анализ объектных массивов
 	var objectArrays []ObjectArrayDump
@@ -37,7 +43,10 @@ func AnalyzeLongArrays(minElements int) (result AnalyzeResult) {
 	}
 
 	for _, arr := range objectArrays {
-		size := ArrayHeaderSize + arr.NumberOfElements*8
+		if reachable != nil && !reachable(arr.ID) {
+			continue
+		}
+		size := model.arraySize(Object, arr.NumberOfElements)
 		className := getClassNameFromDB(arr.ArrayClassObjectID)
 		arrays = append(arrays, ArrayInfo{
 			Kind:        "ObjectArray: " + className,
@@ -55,7 +64,10 @@ func AnalyzeLongArrays(minElements int) (result AnalyzeResult) {
 	}
 
 	for _, arr := range primitiveArrays {
-		size := ArrayHeaderSize + arr.NumberOfElements*arr.Type.GetSize()
+		if reachable != nil && !reachable(arr.ID) {
+			continue
+		}
+		size := model.arraySize(arr.Type, arr.NumberOfElements)
 		arrays = append(arrays, ArrayInfo{
 			Kind:        "PrimitiveArray: " + arr.Type.GetName(),
 			ObjectID:    arr.ID,
@@ -86,12 +98,15 @@ func AnalyzeLongArrays(minElements int) (result AnalyzeResult) {
 type HashMapInfo struct {
 	ObjectID  ID
 	ClassName string
-	Size      int32
+	Size      int64 // экземпляр вместе с таблицей бакетов
+	Entries   int64
+	Capacity  int64
+	Wasted    int64
 }
 
 // AnalyzeHashMapOverheads:
-// ищет экземпляры, у которых имя класса содержит "HashMap"
-// и выводит их размер, что может служить индикатором высокого оверхеда.
+// декодирует size и длину таблицы бакетов у хэш-таблиц JDK (HashMap, Hashtable,
+// ConcurrentHashMap и их наследников) и выводит самые затратные из них.
 func AnalyzeHashMapOverheads(maxSize int) (result AnalyzeResult) {
 	result = AnalyzeResult{
 		Header: fmt.Sprintf("Анализ оверхеда HashMap (maxSize = %d)", maxSize),
@@ -103,29 +118,41 @@ func AnalyzeHashMapOverheads(maxSize int) (result AnalyzeResult) {
 		return result
 	}
 
-	var hashMaps []HashMapInfo
-
-	// Получаем все экземпляры из базы данных
-	var instances []InstanceDump
-	if err := GetDB().Find(&instances).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Error retrieving instances: %v\n", err))
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	collections, err := g.decodeAllCollections()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding collections: %v\n", err))
 		return result
 	}
 
-	// Фильтруем экземпляры HashMap
-	for _, instance := range instances {
-		className := getClassNameFromDB(instance.ClassObjectID)
-		if strings.Contains(className, "HashMap") {
-			hashMaps = append(hashMaps, HashMapInfo{
-				ObjectID:  instance.ID,
-				ClassName: className,
-				Size:      instance.NumberOfBytes,
-			})
+	var hashMaps []HashMapInfo
+	for _, c := range collections {
+		if !c.isMap || c.capacity < 0 {
+			continue
 		}
+		size := g.sizes[c.node]
+		if c.backing != 0 {
+			size += g.sizes[c.backing]
+		}
+		hashMaps = append(hashMaps, HashMapInfo{
+			ObjectID:  g.ids[c.node],
+			ClassName: g.nodeClassName(c.node),
+			Size:      size,
+			Entries:   c.size,
+			Capacity:  c.capacity,
+			Wasted:    c.wastedBytes(),
+		})
 	}
 
-	// Сортируем по размеру (убывание)
+	// Сортируем по потерянному месту, затем по размеру (убывание)
 	sort.Slice(hashMaps, func(i, j int) bool {
+		if hashMaps[i].Wasted != hashMaps[j].Wasted {
+			return hashMaps[i].Wasted > hashMaps[j].Wasted
+		}
 		return hashMaps[i].Size > hashMaps[j].Size
 	})
 
@@ -137,8 +164,8 @@ func AnalyzeHashMapOverheads(maxSize int) (result AnalyzeResult) {
 			if i >= maxSize {
 				break
 			}
-			result.Body = append(result.Body, fmt.Sprintf("%d. ID: %d, Класс: %s, Размер экземпляра: %d байт\n",
-				i+1, info.ObjectID, info.ClassName, info.Size))
+			result.Body = append(result.Body, fmt.Sprintf("%d. ID: %d, Класс: %s, Размер с таблицей: %d байт, Элементов: %d, Ёмкость: %d, Потеряно: %d байт\n",
+				i+1, info.ObjectID, info.ClassName, info.Size, info.Entries, info.Capacity, info.Wasted))
 		}
 	}
 
@@ -169,7 +196,51 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 		return result
 	}
 
+	owners, errs := findArrayOwners(maxElements)
+	for _, err := range errs {
+		result.Body = append(result.Body, err.Error()+"\n")
+	}
+
+	sort.Slice(owners, func(i, j int) bool {
+		return owners[i].ArrayElements > owners[j].ArrayElements
+	})
+
+
+	if len(owners) == 0 {
+		result.Body = append(result.Body, fmt.Sprintf("Массивы с количеством элементов >= %d и их владельцы не найдены\n", maxElements))
+	} else {
+		result.Body = append(result.Body, fmt.Sprintf("Найдено %d массивов с владельцами:\n\n", len(owners)))
+
+		for i, owner := range owners {
+			ownerDescription := ""
+			switch owner.OwnerType {
+			case "InstanceField":
+				ownerDescription = fmt.Sprintf("поле '%s' экземпляра класса '%s' (ID: %d)",
+					owner.FieldName, owner.OwnerClass, owner.OwnerID)
+			case "StaticField":
+				ownerDescription = fmt.Sprintf("статическое поле '%s' класса '%s' (ID: %d)",
+					owner.FieldName, owner.OwnerClass, owner.OwnerID)
+			case "ArrayElement":
+				ownerDescription = fmt.Sprintf("элемент %s массива '%s' (ID: %d)",
+					owner.FieldName, owner.OwnerClass, owner.OwnerID)
+			default:
+				ownerDescription = fmt.Sprintf("неизвестный тип владельца: %s (ID: %d)",
+					owner.OwnerType, owner.OwnerID)
+			}
+
+			result.Body = append(result.Body, fmt.Sprintf("%d. Массив ID: %d, Тип: %s, Элементов: %d\n   Владелец: %s\n\n",
+				i+1, owner.ArrayID, owner.ArrayType, owner.ArrayElements, ownerDescription))
+		}
+	}
+
+	return result
+}
+
+// findArrayOwners находит поля экземпляров, статические поля и массивы,
+// которые ссылаются на массивы с количеством элементов >= minElements.
+func findArrayOwners(minElements int) ([]ArrayOwnerInfo, []error) {
 	var owners []ArrayOwnerInfo
+	var errs []error
 
 	// 1. Поиск объектных массивов как полей экземпляров
 	objectArrayFieldQuery := `
@@ -194,8 +265,8 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 	`
 
 	var objectArrayFieldResults []ArrayOwnerInfo
-	if err := GetDB().Raw(objectArrayFieldQuery, maxElements).Scan(&objectArrayFieldResults).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Ошибка при поиске объектных массивов в полях экземпляров: %v\n", err))
+	if err := GetDB().Raw(objectArrayFieldQuery, minElements).Scan(&objectArrayFieldResults).Error; err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при поиске объектных массивов в полях экземпляров: %w", err))
 	} else {
 		owners = append(owners, objectArrayFieldResults...)
 	}
@@ -231,8 +302,8 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 	`
 
 	var primitiveArrayFieldResults []ArrayOwnerInfo
-	if err := GetDB().Raw(primitiveArrayFieldQuery, maxElements).Scan(&primitiveArrayFieldResults).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Ошибка при поиске примитивных массивов в полях экземпляров: %v\n", err))
+	if err := GetDB().Raw(primitiveArrayFieldQuery, minElements).Scan(&primitiveArrayFieldResults).Error; err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при поиске примитивных массивов в полях экземпляров: %w", err))
 	} else {
 		owners = append(owners, primitiveArrayFieldResults...)
 	}
@@ -258,8 +329,8 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 	`
 
 	var objectArrayStaticResults []ArrayOwnerInfo
-	if err := GetDB().Raw(objectArrayStaticQuery, maxElements).Scan(&objectArrayStaticResults).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Ошибка при поиске объектных массивов в статических полях: %v\n", err))
+	if err := GetDB().Raw(objectArrayStaticQuery, minElements).Scan(&objectArrayStaticResults).Error; err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при поиске объектных массивов в статических полях: %w", err))
 	} else {
 		owners = append(owners, objectArrayStaticResults...)
 	}
@@ -293,8 +364,8 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 	`
 
 	var primitiveArrayStaticResults []ArrayOwnerInfo
-	if err := GetDB().Raw(primitiveArrayStaticQuery, maxElements).Scan(&primitiveArrayStaticResults).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Ошибка при поиске примитивных массивов в статических полях: %v\n", err))
+	if err := GetDB().Raw(primitiveArrayStaticQuery, minElements).Scan(&primitiveArrayStaticResults).Error; err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при поиске примитивных массивов в статических полях: %w", err))
 	} else {
 		owners = append(owners, primitiveArrayStaticResults...)
 	}
@@ -342,45 +413,34 @@ func AnalyzeArrayOwners(maxElements int) (result AnalyzeResult) {
 	`
 
 	var arrayInArrayResults []ArrayOwnerInfo
-	if err := GetDB().Raw(arrayInArrayQuery, maxElements, maxElements).Scan(&arrayInArrayResults).Error; err != nil {
-		result.Body = append(result.Body, fmt.Sprintf("Ошибка при поиске массивов в других массивах: %v\n", err))
+	if err := GetDB().Raw(arrayInArrayQuery, minElements, minElements).Scan(&arrayInArrayResults).Error; err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при поиске массивов в других массивах: %w", err))
 	} else {
 		owners = append(owners, arrayInArrayResults...)
 	}
 
-	sort.Slice(owners, func(i, j int) bool {
-		return owners[i].ArrayElements > owners[j].ArrayElements
-	})
-
-
-	if len(owners) == 0 {
-		result.Body = append(result.Body, fmt.Sprintf("Массивы с количеством элементов >= %d и их владельцы не найдены\n", maxElements))
-	} else {
-		result.Body = append(result.Body, fmt.Sprintf("Найдено %d массивов с владельцами:\n\n", len(owners)))
-
-		for i, owner := range owners {
-			ownerDescription := ""
-			switch owner.OwnerType {
-			case "InstanceField":
-				ownerDescription = fmt.Sprintf("поле '%s' экземпляра класса '%s' (ID: %d)",
-					owner.FieldName, owner.OwnerClass, owner.OwnerID)
-			case "StaticField":
-				ownerDescription = fmt.Sprintf("статическое поле '%s' класса '%s' (ID: %d)",
-					owner.FieldName, owner.OwnerClass, owner.OwnerID)
-			case "ArrayElement":
-				ownerDescription = fmt.Sprintf("элемент %s массива '%s' (ID: %d)",
-					owner.FieldName, owner.OwnerClass, owner.OwnerID)
-			default:
-				ownerDescription = fmt.Sprintf("неизвестный тип владельца: %s (ID: %d)",
-					owner.OwnerType, owner.OwnerID)
-			}
+	// Массивы и владельцы, недостижимые от GC roots, пропускаются так же, как в анализах графа
+	reachable, err := reachableFilter()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Ошибка при построении графа объектов: %w", err))
+		return owners, errs
+	}
+	return reachableOwners(owners, reachable), errs
+}
 
-			result.Body = append(result.Body, fmt.Sprintf("%d. Массив ID: %d, Тип: %s, Элементов: %d\n   Владелец: %s\n\n",
-				i+1, owner.ArrayID, owner.ArrayType, owner.ArrayElements, ownerDescription))
+// reachableOwners оставляет записи, у которых и массив, и владелец проходят фильтр reachable.
+// Пустой фильтр оставляет все записи.
+func reachableOwners(owners []ArrayOwnerInfo, reachable func(ID) bool) []ArrayOwnerInfo {
+	if reachable == nil {
+		return owners
+	}
+	kept := owners[:0]
+	for _, owner := range owners {
+		if reachable(owner.ArrayID) && reachable(owner.OwnerID) {
+			kept = append(kept, owner)
 		}
 	}
-
-	return result
+	return kept
 }
 
 type OwnerArraysInfo struct {
@@ -429,6 +489,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     }
 
     var allResults []OwnerArrayResult
+    model := currentSizeModel()
 
     // 1. Объектные массивы как поля экземпляров
     objectArrayFieldQuery := `
@@ -440,7 +501,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
             oad."ID" as array_id,
             COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || oad."ArrayClassObjectID"::text) || '[]' as array_type,
             oad."NumberOfElements" as array_elements,
-            (? + oad."NumberOfElements" * 8) as array_size
+            ` + model.objectArraySizeSQL("oad.\"NumberOfElements\"") + ` as array_size
         FROM "ObjectArrayDump" oad
         JOIN "InstanceFieldValues" ifv ON decode(lpad(to_hex(oad."ID"), 16, '0'), 'hex') = ifv."Value" AND ifv."Type" = 2
         JOIN "InstanceDump" id ON ifv."InstanceDumpID" = id."ID"
@@ -454,7 +515,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var objectArrayFieldResults []OwnerArrayResult
-    if err := GetDB().Raw(objectArrayFieldQuery, ArrayHeaderSize).Scan(&objectArrayFieldResults).Error; err != nil {
+    if err := GetDB().Raw(objectArrayFieldQuery).Scan(&objectArrayFieldResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении объектных массивов в полях экземпляров: %v\n", err))
     } else {
         allResults = append(allResults, objectArrayFieldResults...)
@@ -480,20 +541,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
                 ELSE 'unknown[]'
             END as array_type,
             pad."NumberOfElements" as array_elements,
-            (? + pad."NumberOfElements" * 
-                CASE pad."Type"
-                    WHEN 4 THEN 1    -- bool: 1 byte
-                    WHEN 8 THEN 1    -- byte: 1 byte
-                    WHEN 5 THEN 2    -- char: 2 bytes
-                    WHEN 9 THEN 2    -- short: 2 bytes
-                    WHEN 6 THEN 4    -- float: 4 bytes
-                    WHEN 10 THEN 4   -- int: 4 bytes
-                    WHEN 2 THEN 8    -- object: 8 bytes
-                    WHEN 7 THEN 8    -- double: 8 bytes
-                    WHEN 11 THEN 8   -- long: 8 bytes
-                    ELSE 0
-                END
-            ) as array_size
+            ` + model.primitiveArraySizeSQL("pad.\"NumberOfElements\"", "pad.\"Type\"") + ` as array_size
         FROM "PrimitiveArrayDump" pad
         JOIN "InstanceFieldValues" ifv ON decode(lpad(to_hex(pad."ID"), 16, '0'), 'hex') = ifv."Value" AND ifv."Type" = 2
         JOIN "InstanceDump" id ON ifv."InstanceDumpID" = id."ID"
@@ -505,7 +553,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var primitiveArrayFieldResults []OwnerArrayResult
-    if err := GetDB().Raw(primitiveArrayFieldQuery, ArrayHeaderSize).Scan(&primitiveArrayFieldResults).Error; err != nil {
+    if err := GetDB().Raw(primitiveArrayFieldQuery).Scan(&primitiveArrayFieldResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении примитивных массивов в полях экземпляров: %v\n", err))
     } else {
         allResults = append(allResults, primitiveArrayFieldResults...)
@@ -521,7 +569,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
             oad."ID" as array_id,
             COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || oad."ArrayClassObjectID"::text) || '[]' as array_type,
             oad."NumberOfElements" as array_elements,
-            (? + oad."NumberOfElements" * 8) as array_size
+            ` + model.objectArraySizeSQL("oad.\"NumberOfElements\"") + ` as array_size
         FROM "ObjectArrayDump" oad
         JOIN "StaticFieldRecord" sfr ON decode(lpad(to_hex(oad."ID"), 16, '0'), 'hex') = sfr."Value" AND sfr."Type" = 2
         LEFT JOIN "LoadClass" lc ON oad."ArrayClassObjectID" = lc."ClassObjectID"
@@ -533,7 +581,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var objectArrayStaticResults []OwnerArrayResult
-    if err := GetDB().Raw(objectArrayStaticQuery, ArrayHeaderSize).Scan(&objectArrayStaticResults).Error; err != nil {
+    if err := GetDB().Raw(objectArrayStaticQuery).Scan(&objectArrayStaticResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении объектных массивов в статических полях: %v\n", err))
     } else {
         allResults = append(allResults, objectArrayStaticResults...)
@@ -559,20 +607,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
                 ELSE 'unknown[]'
             END as array_type,
             pad."NumberOfElements" as array_elements,
-            (? + pad."NumberOfElements" * 
-                CASE pad."Type"
-                    WHEN 4 THEN 1    -- bool: 1 byte
-                    WHEN 8 THEN 1    -- byte: 1 byte
-                    WHEN 5 THEN 2    -- char: 2 bytes
-                    WHEN 9 THEN 2    -- short: 2 bytes
-                    WHEN 6 THEN 4    -- float: 4 bytes
-                    WHEN 10 THEN 4   -- int: 4 bytes
-                    WHEN 2 THEN 8    -- object: 8 bytes
-                    WHEN 7 THEN 8    -- double: 8 bytes
-                    WHEN 11 THEN 8   -- long: 8 bytes
-                    ELSE 0
-                END
-            ) as array_size
+            ` + model.primitiveArraySizeSQL("pad.\"NumberOfElements\"", "pad.\"Type\"") + ` as array_size
         FROM "PrimitiveArrayDump" pad
         JOIN "StaticFieldRecord" sfr ON decode(lpad(to_hex(pad."ID"), 16, '0'), 'hex') = sfr."Value" AND sfr."Type" = 2
         LEFT JOIN "LoadClass" owner_lc ON sfr."ClassDumpID" = owner_lc."ClassObjectID"
@@ -582,7 +617,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var primitiveArrayStaticResults []OwnerArrayResult
-    if err := GetDB().Raw(primitiveArrayStaticQuery, ArrayHeaderSize).Scan(&primitiveArrayStaticResults).Error; err != nil {
+    if err := GetDB().Raw(primitiveArrayStaticQuery).Scan(&primitiveArrayStaticResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении примитивных массивов в статических полях: %v\n", err))
     } else {
         allResults = append(allResults, primitiveArrayStaticResults...)
@@ -598,7 +633,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
             oad_inner."ID" as array_id,
             COALESCE(REPLACE(convert_from(s_inner."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || oad_inner."ArrayClassObjectID"::text) || '[]' as array_type,
             oad_inner."NumberOfElements" as array_elements,
-            (? + oad_inner."NumberOfElements" * 8) as array_size
+            ` + model.objectArraySizeSQL("oad_inner.\"NumberOfElements\"") + ` as array_size
         FROM "ObjectArrayElement" oae
         JOIN "ObjectArrayDump" oad_outer ON oae."ObjectArrayDumpID" = oad_outer."ID"
         JOIN "ObjectArrayDump" oad_inner ON oae."InstanceDumpID" = oad_inner."ID"
@@ -610,7 +645,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var objectArrayInArrayResults []OwnerArrayResult
-    if err := GetDB().Raw(objectArrayInArrayQuery, ArrayHeaderSize).Scan(&objectArrayInArrayResults).Error; err != nil {
+    if err := GetDB().Raw(objectArrayInArrayQuery).Scan(&objectArrayInArrayResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении объектных массивов в других массивах: %v\n", err))
     } else {
         allResults = append(allResults, objectArrayInArrayResults...)
@@ -636,20 +671,7 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
                 ELSE 'unknown[]'
             END as array_type,
             pad_inner."NumberOfElements" as array_elements,
-            (? + pad_inner."NumberOfElements" * 
-                CASE pad_inner."Type"
-                    WHEN 4 THEN 1    -- bool: 1 byte
-                    WHEN 8 THEN 1    -- byte: 1 byte
-                    WHEN 5 THEN 2    -- char: 2 bytes
-                    WHEN 9 THEN 2    -- short: 2 bytes
-                    WHEN 6 THEN 4    -- float: 4 bytes
-                    WHEN 10 THEN 4   -- int: 4 bytes
-                    WHEN 2 THEN 8    -- object: 8 bytes
-                    WHEN 7 THEN 8    -- double: 8 bytes
-                    WHEN 11 THEN 8   -- long: 8 bytes
-                    ELSE 0
-                END
-            ) as array_size
+            ` + model.primitiveArraySizeSQL("pad_inner.\"NumberOfElements\"", "pad_inner.\"Type\"") + ` as array_size
         FROM "ObjectArrayElement" oae
         JOIN "ObjectArrayDump" oad_outer ON oae."ObjectArrayDumpID" = oad_outer."ID"
         JOIN "PrimitiveArrayDump" pad_inner ON oae."InstanceDumpID" = pad_inner."ID"
@@ -659,16 +681,26 @@ func AnalyzeTopArrayOwners(maxOwners int) (result AnalyzeResult) {
     `
 
     var primitiveArrayInArrayResults []OwnerArrayResult
-    if err := GetDB().Raw(primitiveArrayInArrayQuery, ArrayHeaderSize).Scan(&primitiveArrayInArrayResults).Error; err != nil {
+    if err := GetDB().Raw(primitiveArrayInArrayQuery).Scan(&primitiveArrayInArrayResults).Error; err != nil {
         result.Body = append(result.Body, fmt.Sprintf("Ошибка при получении примитивных массивов в других массивах: %v\n", err))
     } else {
         allResults = append(allResults, primitiveArrayInArrayResults...)
     }
 
+    // Массивы и владельцы, недостижимые от GC roots, пропускаются так же, как в анализах графа
+    reachable, err := reachableFilter()
+    if err != nil {
+        result.Body = append(result.Body, fmt.Sprintf("Ошибка при построении графа объектов: %v\n", err))
+        return result
+    }
+
     ownerMap := make(map[string]*OwnerArraysInfo)
     ownerFields := make(map[string]map[string]bool)
 
     for _, row := range allResults {
+        if reachable != nil && (!reachable(row.ArrayID) || !reachable(row.OwnerID)) {
+            continue
+        }
         ownerKey := fmt.Sprintf("%s_%d", row.OwnerType, row.OwnerID)
 
         if _, exists := ownerFields[ownerKey]; !exists {
@@ -0,0 +1,276 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// boxType describes a java.lang wrapper of a primitive type.
+type boxType struct {
+	primitive BasicType
+	// cacheClass keeps preallocated boxes in its static "cache" array
+	cacheClass string
+}
+
+var boxTypes = map[string]boxType{
+	"java.lang.Integer":   {Int, "java.lang.Integer$IntegerCache"},
+	"java.lang.Long":      {Long, "java.lang.Long$LongCache"},
+	"java.lang.Short":     {Short, "java.lang.Short$ShortCache"},
+	"java.lang.Byte":      {Byte, "java.lang.Byte$ByteCache"},
+	"java.lang.Character": {Char, "java.lang.Character$CharacterCache"},
+	"java.lang.Boolean":   {Boolean, "java.lang.Boolean"},
+	"java.lang.Float":     {Float, ""},
+	"java.lang.Double":    {Double, ""},
+}
+
+func (g *heapGraph) boxTypeOf(node int32) (boxType, bool) {
+	if g.kinds[node] != KindInstance {
+		return boxType{}, false
+	}
+	box, ok := boxTypes[g.classNames[g.classes[node]]]
+	return box, ok
+}
+
+// cachedBoxes returns boxes preallocated by the JDK: contents of IntegerCache and
+// the other caches and Boolean.TRUE/FALSE.
+func (g *heapGraph) cachedBoxes() map[int32]bool {
+	cached := make(map[int32]bool)
+	for _, box := range boxTypes {
+		if box.cacheClass == "" {
+			continue
+		}
+		for _, classID := range g.classIDsByName(box.cacheClass) {
+			classNode, ok := g.index[classID]
+			if !ok {
+				continue
+			}
+			for _, target := range g.out[classNode] {
+				switch g.kinds[target] {
+				case KindInstance:
+					cached[target] = true
+				case KindObjectArray:
+					for _, element := range g.out[target] {
+						if _, ok := g.boxTypeOf(element); ok {
+							cached[element] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	for node := range cached {
+		if _, ok := g.boxTypeOf(node); !ok {
+			delete(cached, node)
+		}
+	}
+	return cached
+}
+
+// setPresentValues returns the shared dummy values HashSet puts into its map for every element.
+func (g *heapGraph) setPresentValues() map[int32]bool {
+	present := make(map[int32]bool)
+	for _, classID := range g.classIDsByName("java.util.HashSet") {
+		for _, target := range g.out[g.index[classID]] {
+			if g.kinds[target] == KindInstance && g.classNames[g.classes[target]] == "java.lang.Object" {
+				present[target] = true
+			}
+		}
+	}
+	return present
+}
+
+// collectionElements counts elements of a collection backed by an object array
+// and how many of them are boxes. Entries of hash tables are followed to their keys and values,
+// for sets only to the keys, values in present are skipped.
+func (g *heapGraph) collectionElements(c collectionInfo, present map[int32]bool) (total, boxed []int32) {
+	if c.backing == 0 || g.kinds[c.backing] != KindObjectArray {
+		return nil, nil
+	}
+	hashed := c.isMap || c.wrapped != 0
+
+	count := func(node int32) {
+		total = append(total, node)
+		if _, ok := g.boxTypeOf(node); ok {
+			boxed = append(boxed, node)
+		}
+	}
+	for _, element := range g.out[c.backing] {
+		if g.kinds[element] == KindClass {
+			continue
+		}
+		if _, ok := g.boxTypeOf(element); ok || !hashed {
+			count(element)
+			continue
+		}
+
+		// Walk the bucket chain, entries of one table share the class
+		entryClass := g.classes[element]
+		visited := map[int32]bool{element: true}
+		chain := []int32{element}
+		for len(chain) > 0 {
+			entry := chain[len(chain)-1]
+			chain = chain[:len(chain)-1]
+			for _, target := range g.out[entry] {
+				switch {
+				case g.kinds[target] == KindClass:
+				case c.wrapped != 0 && present[target]:
+				case g.kinds[target] == KindInstance && g.classes[target] == entryClass:
+					if !visited[target] {
+						visited[target] = true
+						chain = append(chain, target)
+					}
+				default:
+					count(target)
+				}
+			}
+		}
+	}
+	return total, boxed
+}
+
+// AnalyzeBoxedPrimitives counts boxed primitives, separates JDK cached boxes from
+// allocated ones and finds collections that mostly hold boxes.
+func AnalyzeBoxedPrimitives(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nBoxed primitives (top %d collection owners)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	cached := g.cachedBoxes()
+
+	type boxStats struct {
+		name      string
+		count     int64
+		cached    int64
+		allocated int64 // bytes of boxes outside of the caches
+	}
+	byClass := make(map[string]*boxStats)
+	for node := range g.kinds {
+		if _, ok := g.boxTypeOf(int32(node)); !ok {
+			continue
+		}
+		name := g.nodeClassName(int32(node))
+		stats, ok := byClass[name]
+		if !ok {
+			stats = &boxStats{name: name}
+			byClass[name] = stats
+		}
+		stats.count++
+		if cached[int32(node)] {
+			stats.cached++
+		} else {
+			stats.allocated += g.sizes[node]
+		}
+	}
+	if len(byClass) == 0 {
+		result.Body = append(result.Body, "No boxed primitives found\n")
+		return result
+	}
+
+	classes := make([]*boxStats, 0, len(byClass))
+	for _, stats := range byClass {
+		classes = append(classes, stats)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].allocated != classes[j].allocated {
+			return classes[i].allocated > classes[j].allocated
+		}
+		return classes[i].name < classes[j].name
+	})
+	result.Body = append(result.Body, "Boxes by type:\n")
+	for i, stats := range classes {
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Count: %d, Cached: %d, Allocated: %d, Allocated size: %d bytes\n",
+			i+1, stats.name, stats.count, stats.cached, stats.count-stats.cached, stats.allocated))
+	}
+
+	collections, err := g.decodeAllCollections()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding collections: %v\n", err))
+		return result
+	}
+
+	// A primitive collection keeps the value inline instead of a reference to a box,
+	// the box itself is saved unless it is shared from the JDK cache
+	type ownerStats struct {
+		key         string
+		collections int64
+		boxed       int64
+		saved       int64
+	}
+	type boxedCollection struct {
+		info  collectionInfo
+		boxed int64
+		saved int64
+	}
+	var boxedCollections []boxedCollection
+	var nodes []int32
+	var totalSaved int64
+	present := g.setPresentValues()
+	for _, c := range collections {
+		total, boxed := g.collectionElements(c, present)
+		if len(boxed) == 0 || 2*len(boxed) <= len(total) {
+			continue
+		}
+		var saved int64
+		for _, node := range boxed {
+			box, _ := g.boxTypeOf(node)
+			saved += g.model.ReferenceSize - int64(box.primitive.GetSize())
+			if !cached[node] {
+				saved += g.sizes[node]
+			}
+		}
+		boxedCollections = append(boxedCollections, boxedCollection{info: c, boxed: int64(len(boxed)), saved: saved})
+		nodes = append(nodes, c.node)
+		totalSaved += saved
+	}
+	fields, err := g.loadReferrers(nodes)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	byOwner := make(map[string]*ownerStats)
+	for _, c := range boxedCollections {
+		keys := g.ownerKeys(c.info.node, fields)
+		if len(keys) == 0 {
+			keys = []string{"<unreferenced>"}
+		}
+		for _, key := range keys {
+			key = c.info.kind + " in " + key
+			stats, ok := byOwner[key]
+			if !ok {
+				stats = &ownerStats{key: key}
+				byOwner[key] = stats
+			}
+			stats.collections++
+			stats.boxed += c.boxed
+			stats.saved += c.saved
+		}
+	}
+
+	result.Body = append(result.Body, fmt.Sprintf("\nCollections holding mostly boxes: %d, primitive collections would save: %d bytes\n",
+		len(boxedCollections), totalSaved))
+	owners := make([]*ownerStats, 0, len(byOwner))
+	for _, stats := range byOwner {
+		owners = append(owners, stats)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].saved != owners[j].saved {
+			return owners[i].saved > owners[j].saved
+		}
+		return owners[i].key < owners[j].key
+	})
+	for i, owner := range owners {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Collections: %d, Boxed elements: %d, Saved: %d bytes\n",
+			i+1, owner.key, owner.collections, owner.boxed, owner.saved))
+	}
+	return result
+}
@@ -62,7 +62,8 @@ func readHeader(file *os.File) HprofHeader {
 		fmt.Errorf("Error reading header text: %v\n", err)
 		return header
 	}
-	header.Magic = string(magic)
+	// The terminating zero byte can't be stored in a text column
+	header.Magic = strings.TrimSuffix(string(magic), "\x00")
 
 	if err := binary.Read(file, binary.BigEndian, &header.IdentifierSize); err != nil {
 		fmt.Errorf("Error reading identifier size: %v\n", err)
@@ -190,12 +191,30 @@ func readStackTrace(reader io.Reader) {
 		if err := GetDB().
 			Model(&StackFrame{}).
 			Where("\"ID\" = ?", frameId).
-			UpdateColumn("\"StackTraceSerialNumber\"", stackTrace.StackTraceSerialNumber).Error; err != nil {
+			UpdateColumns(map[string]interface{}{
+				"StackTraceSerialNumber": stackTrace.StackTraceSerialNumber,
+				"IndexInStackTrace":      i,
+			}).Error; err != nil {
 			fmt.Errorf("Error updating StackFrame with frame ID %d: %v\n", frameId, err)
 		}
 	}
 }
 
+func readStartThreadRecord(reader io.Reader) {
+	startThread := StartThread{
+		ThreadSerialNumber:      readInt32(reader),
+		ThreadObjectId:          readID(reader),
+		StackTraceSerialNumber:  readInt32(reader),
+		ThreadNameStringId:      readID(reader),
+		ThreadGroupNameId:       readID(reader),
+		ThreadParentGroupNameId: readID(reader),
+	}
+
+	if err := SaveStartThread(&startThread); err != nil {
+		fmt.Printf("Error saving StartThread to database: %v\n", err)
+	}
+}
+
 func readAllocSites(reader io.Reader) {
 	allocSites := AllocSites{
 		BitMaskSize:            readUint16(reader),
@@ -632,8 +651,6 @@ func readPrimitiveArrayDump(reader io.Reader) {
 // 	ClassObjectIdToLoadClassMap     = make(map[ID]LoadClass)
 // )
 
-const ArrayHeaderSize = int32(16)
-
 func ParseHeapDump(heapDumpFile *os.File) {
 	type readerFunction func(io.Reader)
 
@@ -653,9 +670,14 @@ func ParseHeapDump(heapDumpFile *os.File) {
 		PrimitiveArrayDumpTag: readPrimitiveArrayDump,
 	}
 
+	resetHeapGraph()
+
 	// Read the header
 	header := readHeader(heapDumpFile)
 	fmt.Printf("Header: %+v\n", header)
+	if err := SaveHprofHeader(&header); err != nil {
+		fmt.Printf("Error saving header to database: %v\n", err)
+	}
 
 	// Read records
 	t := 0
@@ -682,6 +704,8 @@ func ParseHeapDump(heapDumpFile *os.File) {
 			readStackFrame(record.DataReader)
 		case StackTraceTag:
 			readStackTrace(record.DataReader)
+		case StartThreadTag:
+			readStartThreadRecord(record.DataReader)
 		case AllocSitesTag:
 			readAllocSites(record.DataReader)
 		case HeapDumpTag, HeapDumpSegmentTag:
@@ -743,42 +767,43 @@ func (result AnalyzeResult) ToHTML() string {
 	return buf.String()
 }
 
+// PrintSizeClasses sums shallow sizes of the instances of every class with the size of its static fields.
+// Sizes follow the size model instead of the field data lengths written to the dump.
 func PrintSizeClasses(max int) (result AnalyzeResult) {
 	result = AnalyzeResult{
 		Header: fmt.Sprintf("\n\nTop %d classes by size\n", max),
 		Body:   make([]string, max),
 	}
 
-	type ClassSizeInfo struct {
-		ClassID       ID     `gorm:"column:class_id"`
-		ClassName     string `gorm:"column:class_name"`
-		InstanceSize  int64  `gorm:"column:instance_size"`
-		InstancesSize int64  `gorm:"column:instances_size"`
-		TotalSize     int64  `gorm:"column:total_size"`
-	}
-
-	// Один оптимизированный запрос для получения всех данных
-	var classSizeInfos []ClassSizeInfo
-	query := `
-		SELECT 
-			cd."ID" as class_id,
-			COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || cd."ID"::text) as class_name,
-			cd."InstanceSize" as instance_size,
-			COALESCE(SUM(id."NumberOfBytes"), 0) as instances_size,
-			cd."InstanceSize" + COALESCE(SUM(id."NumberOfBytes"), 0) as total_size
-		FROM "ClassDump" cd
-		LEFT JOIN "InstanceDump" id ON cd."ID" = id."ClassObjectID"
-		LEFT JOIN "LoadClass" lc ON cd."ID" = lc."ClassObjectID"
-		LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
-		GROUP BY cd."ID", cd."InstanceSize", s."Bytes"
-		ORDER BY total_size DESC
-		LIMIT ?
-	`
-
-	if err := GetDB().Raw(query, max).Scan(&classSizeInfos).Error; err != nil {
+	g, err := getHeapGraph()
+	if err != nil {
 		fmt.Printf("Error getting class size information: %v\n", err)
 		return result
 	}
+	result.Header = fmt.Sprintf("\n\nTop %d classes by size, size model %s\n", max, g.model.label())
+
+	type ClassSizeInfo struct {
+		ClassID   ID
+		ClassName string
+		TotalSize int64
+	}
+
+	sizeOf := make(map[ID]int64)
+	for node, kind := range g.kinds {
+		if kind == KindClass || kind == KindInstance {
+			sizeOf[g.classes[node]] += g.sizes[node]
+		}
+	}
+	classSizeInfos := make([]ClassSizeInfo, 0, len(sizeOf))
+	for id, size := range sizeOf {
+		classSizeInfos = append(classSizeInfos, ClassSizeInfo{id, g.className(id), size})
+	}
+	sort.Slice(classSizeInfos, func(i, j int) bool {
+		if classSizeInfos[i].TotalSize != classSizeInfos[j].TotalSize {
+			return classSizeInfos[i].TotalSize > classSizeInfos[j].TotalSize
+		}
+		return classSizeInfos[i].ClassID < classSizeInfos[j].ClassID
+	})
 
 	// Заполняем результат
 	for i, info := range classSizeInfos {
@@ -805,12 +830,29 @@ func PrintCountInstances(max int) (result AnalyzeResult) {
 	}
 
 	// Получаем количество экземпляров для каждого класса из базы данных
-	var classInstanceCounts []struct {
+	type ClassCount struct {
 		ClassObjectID ID
 		Count         int64
 	}
+	var classInstanceCounts []ClassCount
 
-	if err := GetDB().Table("InstanceDump").
+	if graphOptions.ExcludeUnreachable {
+		// Only reachable instances are counted, the graph has them already
+		g, err := getHeapGraph()
+		if err != nil {
+			fmt.Printf("Error building heap graph: %v\n", err)
+			return result
+		}
+		counts := make(map[ID]int64)
+		for node, kind := range g.kinds {
+			if kind == KindInstance {
+				counts[g.classes[node]]++
+			}
+		}
+		for classID, count := range counts {
+			classInstanceCounts = append(classInstanceCounts, ClassCount{classID, count})
+		}
+	} else if err := GetDB().Table("InstanceDump").
 		Select("\"ClassObjectID\", COUNT(*) as count").
 		Group("\"ClassObjectID\"").
 		Scan(&classInstanceCounts).Error; err != nil {
@@ -837,76 +879,68 @@ func PrintCountInstances(max int) (result AnalyzeResult) {
 	return result
 }
 
+// PrintObjectLoadersInfo prints class loaders as a tree following ClassLoader.parent
+// with classes, instances, static fields and retained size of every loader.
+// Up to max classes with the most instances are listed under each loader.
 func PrintObjectLoadersInfo(max int) (result AnalyzeResult) {
 	result = AnalyzeResult{
-		Header: "\n\nObject loaders info\n",
+		Header: "\n\nClass loader tree\n",
 		Body:   make([]string, 0),
 	}
 
-	type LoaderInfo struct {
-		LoaderID   ID     `gorm:"column:loader_id"`
-		LoaderName string `gorm:"column:loader_name"`
-		ClassCount int64  `gorm:"column:class_count"`
-	}
-
-	var loaderInfos []LoaderInfo
-	query := `
-		SELECT 
-			cd."ClassLoaderObjectID" as loader_id,
-			CASE 
-				WHEN cd."ClassLoaderObjectID" = 0 THEN 'Bootstrap ClassLoader (System)'
-				ELSE COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown loader ' || cd."ClassLoaderObjectID"::text)
-			END as loader_name,
-			COUNT(*) as class_count
-		FROM "ClassDump" cd
-		LEFT JOIN "InstanceDump" id ON cd."ClassLoaderObjectID" = id."ID"
-		LEFT JOIN "LoadClass" lc ON id."ClassObjectID" = lc."ClassObjectID"
-		LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
-		GROUP BY cd."ClassLoaderObjectID", loader_name
-		ORDER BY class_count DESC
-	`
-
-	if err := GetDB().Raw(query).Scan(&loaderInfos).Error; err != nil {
-		fmt.Printf("Error getting loader info: %v\n", err)
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
 		return result
 	}
+	dom := g.dominators()
+	loaders := g.classLoaders()
+	children := g.loaderTree(loaders)
 
-	for _, loaderInfo := range loaderInfos {
-		result.Body = append(result.Body, fmt.Sprintf("Loader ID: %d, Name: %s, Number of classes: %d\n",
-			loaderInfo.LoaderID, loaderInfo.LoaderName, loaderInfo.ClassCount))
-
-		type ClassInfo struct {
-			ClassID   ID     `gorm:"column:class_id"`
-			ClassName string `gorm:"column:class_name"`
+	instancesOf := make(map[ID]int64)
+	for node, kind := range g.kinds {
+		if kind == KindInstance || kind == KindObjectArray {
+			instancesOf[g.classes[node]]++
 		}
+	}
 
-		var classInfos []ClassInfo
-		classQuery := `
-			SELECT 
-				cd."ID" as class_id,
-				COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || cd."ID"::text) as class_name
-			FROM "ClassDump" cd
-			LEFT JOIN "LoadClass" lc ON cd."ID" = lc."ClassObjectID"
-			LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
-			WHERE cd."ClassLoaderObjectID" = ?
-			LIMIT ?
-		`
+	type frame struct {
+		loader ID
+		depth  int
+	}
+	stack := []frame{{0, 0}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		info := loaders[top.loader]
+		indent := strings.Repeat("  ", top.depth)
 
-		if err := GetDB().Raw(classQuery, loaderInfo.LoaderID, max).Scan(&classInfos).Error; err != nil {
-			fmt.Printf("Error getting classes for loader %d: %v\n", loaderInfo.LoaderID, err)
-			continue
+		retained := "n/a"
+		if node, ok := g.index[top.loader]; ok && top.loader != 0 {
+			retained = fmt.Sprintf("%d", dom.retained[node])
 		}
+		result.Body = append(result.Body, fmt.Sprintf("%s%s: Classes: %d, Instances: %d, Statics: %d, Retained: %s\n",
+			indent, g.describeLoader(top.loader), len(info.classes), info.instances, info.statics, retained))
 
-		for i, classInfo := range classInfos {
+		classes := append([]ID(nil), info.classes...)
+		sort.Slice(classes, func(i, j int) bool {
+			if instancesOf[classes[i]] != instancesOf[classes[j]] {
+				return instancesOf[classes[i]] > instancesOf[classes[j]]
+			}
+			return classes[i] < classes[j]
+		})
+		for i, class := range classes {
 			if i == max {
-				result.Body = append(result.Body, "\t\t...\n")
+				result.Body = append(result.Body, fmt.Sprintf("%s\t...\n", indent))
 				break
 			}
-			result.Body = append(result.Body, fmt.Sprintf("\t\tClass ID: %d, Name: %s\n", classInfo.ClassID, classInfo.ClassName))
+			result.Body = append(result.Body, fmt.Sprintf("%s\tClass ID: %d, Instances: %d, Name: %s\n",
+				indent, class, instancesOf[class], g.className(class)))
 		}
 
-		if len(classInfos) == max && loaderInfo.ClassCount > int64(max) {
-			result.Body = append(result.Body, "\t\t...\n")
+		subs := children[top.loader]
+		for i := len(subs) - 1; i >= 0; i-- {
+			stack = append(stack, frame{subs[i], top.depth + 1})
 		}
 	}
 	return result
@@ -914,7 +948,7 @@ func PrintObjectLoadersInfo(max int) (result AnalyzeResult) {
 
 func PrintFullClassSize(max int) (result AnalyzeResult) {
 	result = AnalyzeResult{
-		Header: fmt.Sprintf("\n\nTop %d classes by full size (with all depends object)\n", max),
+		Header: fmt.Sprintf("\n\nTop %d classes by retained size\n", max),
 		Body:   make([]string, max),
 	}
 
@@ -938,7 +972,8 @@ func PrintFullClassSize(max int) (result AnalyzeResult) {
 		if i == max {
 			break
 		}
-		result.Body[i] = fmt.Sprintf("%d. Class ID: %d, Size: %d, Name: %s\n", (i + 1), p.id, p.stat.TotalSize, p.stat.ClassName)
+		result.Body[i] = fmt.Sprintf("%d. Class ID: %d, Instances: %d, Shallow: %d, Retained: %d, Name: %s\n",
+			(i + 1), p.id, p.stat.InstanceCount, p.stat.ShallowSize, p.stat.TotalSize, p.stat.ClassName)
 	}
 	return result
 }
@@ -955,64 +990,69 @@ func PrintArrayInfo(max int) (result AnalyzeResult) {
 	}
 
 	var arraySizeInfos []ArraySizeInfo
-
-	objectArrayQuery := `
-		SELECT 
-			COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || oad."ArrayClassObjectID"::text) || '[]' as array_type,
-			SUM(? + oad."NumberOfElements" * 8) as total_size
-		FROM "ObjectArrayDump" oad
-		LEFT JOIN "LoadClass" lc ON oad."ArrayClassObjectID" = lc."ClassObjectID"
-		LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
-		GROUP BY oad."ArrayClassObjectID", s."Bytes"
-		ORDER BY total_size DESC
-	`
-
-	var objectArrayResults []ArraySizeInfo
-	if err := GetDB().Raw(objectArrayQuery, ArrayHeaderSize).Scan(&objectArrayResults).Error; err != nil {
-		fmt.Printf("Error getting ObjectArrayDump size info: %v\n", err)
+	model := currentSizeModel()
+
+	if graphOptions.ExcludeUnreachable {
+		// Only reachable arrays are summed, the graph has them already
+		g, err := getHeapGraph()
+		if err != nil {
+			fmt.Printf("Error building heap graph: %v\n", err)
+			return result
+		}
+		sizes := make(map[string]int64)
+		for node, kind := range g.kinds {
+			if kind == KindObjectArray || kind == KindPrimitiveArray {
+				sizes[g.nodeClassName(int32(node))] += g.sizes[node]
+			}
+		}
+		for arrayType, size := range sizes {
+			arraySizeInfos = append(arraySizeInfos, ArraySizeInfo{ArrayType: arrayType, TotalSize: size})
+		}
 	} else {
-		arraySizeInfos = append(arraySizeInfos, objectArrayResults...)
-	}
-
-	primitiveArrayQuery := `
-		SELECT 
-			CASE pad."Type"
-				WHEN 2 THEN 'object[]'
-				WHEN 4 THEN 'bool[]'
-				WHEN 5 THEN 'char[]'
-				WHEN 6 THEN 'float[]'
-				WHEN 7 THEN 'double[]'
-				WHEN 8 THEN 'byte[]'
-				WHEN 9 THEN 'short[]'
-				WHEN 10 THEN 'int[]'
-				WHEN 11 THEN 'long[]'
-				ELSE 'unknown[]'
-			END as array_type,
-			SUM(
-				? + pad."NumberOfElements" * 
+		objectArrayQuery := `
+			SELECT 
+				COALESCE(REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.'), 'Unknown class ' || oad."ArrayClassObjectID"::text) || '[]' as array_type,
+				SUM(` + model.objectArraySizeSQL("oad.\"NumberOfElements\"") + `) as total_size
+			FROM "ObjectArrayDump" oad
+			LEFT JOIN "LoadClass" lc ON oad."ArrayClassObjectID" = lc."ClassObjectID"
+			LEFT JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
+			GROUP BY oad."ArrayClassObjectID", s."Bytes"
+			ORDER BY total_size DESC
+		`
+
+		var objectArrayResults []ArraySizeInfo
+		if err := GetDB().Raw(objectArrayQuery).Scan(&objectArrayResults).Error; err != nil {
+			fmt.Printf("Error getting ObjectArrayDump size info: %v\n", err)
+		} else {
+			arraySizeInfos = append(arraySizeInfos, objectArrayResults...)
+		}
+
+		primitiveArrayQuery := `
+			SELECT 
 				CASE pad."Type"
-					WHEN 4 THEN 1    -- bool: 1 byte
-					WHEN 8 THEN 1    -- byte: 1 byte
-					WHEN 5 THEN 2    -- char: 2 bytes
-					WHEN 9 THEN 2    -- short: 2 bytes
-					WHEN 6 THEN 4    -- float: 4 bytes
-					WHEN 10 THEN 4   -- int: 4 bytes
-					WHEN 2 THEN 8    -- object: 8 bytes
-					WHEN 7 THEN 8    -- double: 8 bytes
-					WHEN 11 THEN 8   -- long: 8 bytes
-					ELSE 0
-				END
-			) as total_size
-		FROM "PrimitiveArrayDump" pad
-		GROUP BY pad."Type"
-		ORDER BY total_size DESC
-	`
-
-	var primitiveArrayResults []ArraySizeInfo
-	if err := GetDB().Raw(primitiveArrayQuery, ArrayHeaderSize).Scan(&primitiveArrayResults).Error; err != nil {
-		fmt.Printf("Error getting PrimitiveArrayDump size info: %v\n", err)
-	} else {
-		arraySizeInfos = append(arraySizeInfos, primitiveArrayResults...)
+					WHEN 2 THEN 'object[]'
+					WHEN 4 THEN 'bool[]'
+					WHEN 5 THEN 'char[]'
+					WHEN 6 THEN 'float[]'
+					WHEN 7 THEN 'double[]'
+					WHEN 8 THEN 'byte[]'
+					WHEN 9 THEN 'short[]'
+					WHEN 10 THEN 'int[]'
+					WHEN 11 THEN 'long[]'
+					ELSE 'unknown[]'
+				END as array_type,
+				SUM(` + model.primitiveArraySizeSQL("pad.\"NumberOfElements\"", "pad.\"Type\"") + `) as total_size
+			FROM "PrimitiveArrayDump" pad
+			GROUP BY pad."Type"
+			ORDER BY total_size DESC
+		`
+
+		var primitiveArrayResults []ArraySizeInfo
+		if err := GetDB().Raw(primitiveArrayQuery).Scan(&primitiveArrayResults).Error; err != nil {
+			fmt.Printf("Error getting PrimitiveArrayDump size info: %v\n", err)
+		} else {
+			arraySizeInfos = append(arraySizeInfos, primitiveArrayResults...)
+		}
 	}
 
 	// Сортируем все результаты по размеру
@@ -1032,81 +1072,25 @@ func PrintArrayInfo(max int) (result AnalyzeResult) {
 }
 
 type ClassStats struct {
-	ClassName string
-	TotalSize int32
+	ClassName     string
+	InstanceCount int64
+	ShallowSize   int64
+	TotalSize     int64 // retained size of all instances of the class
 }
 
+// CalculateClassSizesFromDB computes retained size per class from the dominator tree,
+// so objects shared between several instances are not counted more than once.
 func CalculateClassSizesFromDB() map[ID]ClassStats {
 	result := make(map[ID]ClassStats)
 
-	// Получаем все классы из базы данных
-	var classes []ClassDump
-	if err := GetDB().Find(&classes).Error; err != nil {
-		fmt.Printf("Error getting classes from database: %v\n", err)
+	g, err := getHeapGraph()
+	if err != nil {
+		fmt.Printf("Error building heap graph: %v\n", err)
 		return result
 	}
 
-	fmt.Printf("Processing %d classes for full size calculation...\n", len(classes))
-
-	for i, classDump := range classes {
-		if i%100 == 0 {
-			fmt.Printf("Processing class %d/%d\n", i+1, len(classes))
-		}
-
-		visited := make(map[ID]bool)
-		var totalSize int64
-
-		// Получаем имя класса
-		className := getClassNameFromDB(classDump.ID)
-
-		// 1. Добавляем размер самого класса (статические поля)
-		classSize := calculateClassSizeFromDB(classDump.ID)
-		totalSize += classSize
-
-		// 2. Получаем все экземпляры данного класса
-		instanceIds := getInstanceIdsForClassFromDB(classDump.ID)
-
-		// 3. Для каждого экземпляра проходим граф ссылок в ширину
-		queue := make([]ID, 0)
-
-		for _, instanceId := range instanceIds {
-			if !visited[instanceId] {
-				visited[instanceId] = true
-				queue = append(queue, instanceId)
-				size := getObjectSizeFromDB(instanceId)
-				totalSize += size
-			}
-		}
-
-		staticRefs := getStaticFieldReferencesFromDB(classDump.ID)
-		for _, refId := range staticRefs {
-			if refId != 0 && !visited[refId] {
-				visited[refId] = true
-				queue = append(queue, refId)
-				size := getObjectSizeFromDB(refId)
-				totalSize += size
-			}
-		}
-
-		for len(queue) > 0 {
-			currentId := queue[0]
-			queue = queue[1:]
-
-			refs := getObjectReferencesFromDB(currentId)
-			for _, refId := range refs {
-				if refId != 0 && !visited[refId] {
-					visited[refId] = true
-					queue = append(queue, refId)
-					size := getObjectSizeFromDB(refId)
-					totalSize += size
-				}
-			}
-		}
-
-		result[classDump.ID] = ClassStats{
-			ClassName: className,
-			TotalSize: int32(totalSize),
-		}
+	for id, stat := range g.retainedByClass() {
+		result[id] = *stat
 	}
 
 	return result
@@ -1134,19 +1118,13 @@ func getClassNameFromDB(classID ID) string {
 }
 
 func calculateClassSizeFromDB(classID ID) int64 {
-	var totalSize int64
-
 	var staticFields []StaticFieldRecord
 	if err := GetDB().Where("\"ClassDumpID\" = ?", classID).Find(&staticFields).Error; err != nil {
 		fmt.Printf("Error getting static fields for class %d: %v\n", classID, err)
 		return 0
 	}
 
-	for _, sf := range staticFields {
-		totalSize += int64(sf.Type.GetSize())
-	}
-
-	return totalSize
+	return currentSizeModel().staticsSize(staticFields)
 }
 
 func getInstanceIdsForClassFromDB(classID ID) []ID {
@@ -1163,17 +1141,17 @@ func getInstanceIdsForClassFromDB(classID ID) []ID {
 func getObjectSizeFromDB(objectID ID) int64 {
 	var instance InstanceDump
 	if err := GetDB().Where("\"ID\" = ?", objectID).First(&instance).Error; err == nil {
-		return int64(instance.NumberOfBytes)
+		return currentSizeModel().instanceSize(getAllInstanceFieldsFromDB(instance.ClassObjectID))
 	}
 
 	var objectArray ObjectArrayDump
 	if err := GetDB().Where("\"ID\" = ?", objectID).First(&objectArray).Error; err == nil {
-		return int64(ArrayHeaderSize + objectArray.NumberOfElements*8)
+		return currentSizeModel().arraySize(Object, objectArray.NumberOfElements)
 	}
 
 	var primitiveArray PrimitiveArrayDump
 	if err := GetDB().Where("\"ID\" = ?", objectID).First(&primitiveArray).Error; err == nil {
-		return int64(ArrayHeaderSize + primitiveArray.NumberOfElements*primitiveArray.Type.GetSize())
+		return currentSizeModel().arraySize(primitiveArray.Type, primitiveArray.NumberOfElements)
 	}
 
 	return 0
@@ -1255,13 +1233,13 @@ func getAllInstanceFieldsFromDB(classID ID) []InstanceFieldRecord {
 
 	for currentClassID != 0 {
 		var fields []InstanceFieldRecord
-		if err := GetDB().Where("\"ClassDumpID\" = ?", currentClassID).Find(&fields).Error; err != nil {
+		if err := GetDB().Where("\"ClassDumpID\" = ?", currentClassID).Order("\"ID\"").Find(&fields).Error; err != nil {
 			fmt.Printf("Error getting instance fields for class %d: %v\n", currentClassID, err)
 			break
 		}
 
-		// Добавляем поля в начало, так как нужно сохранить порядок наследования
-		allFields = append(fields, allFields...)
+		// InstanceDump.Data содержит сначала поля самого класса, затем поля суперклассов
+		allFields = append(allFields, fields...)
 
 		// Получаем суперкласс
 		var classDump ClassDump
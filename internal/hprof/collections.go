@@ -0,0 +1,438 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// collectionSpec describes where a JDK collection keeps its size and backing array.
+type collectionSpec struct {
+	kind       string
+	sizeField  string // empty when the size is derived from other fields
+	arrayField string // empty for linked structures
+	// slotsPerElement is 2 for collections keeping keys and values in one array
+	slotsPerElement int64
+	isMap           bool
+	// loadFactor is the default share of slots a hash table fills before it grows
+	loadFactor float64
+}
+
+// collectionSpecs are keyed by the class name, subclasses use the spec of the nearest superclass.
+var collectionSpecs = map[string]collectionSpec{
+	"java.util.ArrayList":                        {kind: "ArrayList", sizeField: "size", arrayField: "elementData"},
+	"java.util.Vector":                           {kind: "Vector", sizeField: "elementCount", arrayField: "elementData"},
+	"java.util.concurrent.CopyOnWriteArrayList":  {kind: "CopyOnWriteArrayList", arrayField: "array"},
+	"java.util.ArrayDeque":                       {kind: "ArrayDeque", arrayField: "elements"},
+	"java.util.PriorityQueue":                    {kind: "PriorityQueue", sizeField: "size", arrayField: "queue"},
+	"java.util.LinkedList":                       {kind: "LinkedList", sizeField: "size"},
+	"java.util.HashMap":                          {kind: "HashMap", sizeField: "size", arrayField: "table", isMap: true, loadFactor: 0.75},
+	"java.util.Hashtable":                        {kind: "Hashtable", sizeField: "count", arrayField: "table", isMap: true, loadFactor: 0.75},
+	"java.util.WeakHashMap":                      {kind: "WeakHashMap", sizeField: "size", arrayField: "table", isMap: true, loadFactor: 0.75},
+	"java.util.IdentityHashMap":                  {kind: "IdentityHashMap", sizeField: "size", arrayField: "table", slotsPerElement: 2, isMap: true, loadFactor: 2.0 / 3},
+	"java.util.concurrent.ConcurrentHashMap":     {kind: "ConcurrentHashMap", sizeField: "baseCount", arrayField: "table", isMap: true, loadFactor: 0.75},
+	"java.util.TreeMap":                          {kind: "TreeMap", sizeField: "size", isMap: true},
+	"java.util.HashSet":                          {kind: "HashSet"},
+	"java.util.TreeSet":                          {kind: "TreeSet"},
+	"java.lang.AbstractStringBuilder":            {kind: "StringBuilder", sizeField: "count", arrayField: "value"},
+	"java.util.concurrent.CopyOnWriteArraySet":   {kind: "CopyOnWriteArraySet"},
+	"java.util.concurrent.ArrayBlockingQueue":    {kind: "ArrayBlockingQueue", sizeField: "count", arrayField: "items"},
+	"java.util.concurrent.LinkedBlockingDeque":   {kind: "LinkedBlockingDeque", sizeField: "count"},
+	"java.util.concurrent.PriorityBlockingQueue": {kind: "PriorityBlockingQueue", sizeField: "size", arrayField: "queue"},
+}
+
+// collectionDelegates are wrappers whose content lives in another collection.
+var collectionDelegates = map[string]string{
+	"HashSet":             "map",
+	"TreeSet":             "m",
+	"CopyOnWriteArraySet": "al",
+}
+
+// collectionInfo is the decoded state of a collection instance.
+type collectionInfo struct {
+	node     int32
+	kind     string
+	size     int64
+	capacity int64 // -1 for linked structures without backing array
+	backing  int32 // node of the backing array, 0 when it is not allocated
+	slotSize int64 // bytes per element slot of the backing array
+	isMap    bool
+	wrapped  int32 // node of the delegate collection for wrappers like HashSet
+	// loadFactor of hash tables, slots above size/loadFactor are wasted; 0 for other collections
+	loadFactor float64
+}
+
+func (c collectionInfo) wastedSlots() int64 {
+	needed := c.size
+	if c.loadFactor > 0 {
+		needed = int64(math.Ceil(float64(c.size) / c.loadFactor))
+	}
+	if c.capacity <= needed {
+		return 0
+	}
+	return c.capacity - needed
+}
+
+func (c collectionInfo) wastedBytes() int64 {
+	return c.wastedSlots() * c.slotSize
+}
+
+// collectionSpecOf finds the spec of the class or of its nearest known superclass.
+func (g *heapGraph) collectionSpecOf(classID ID) (collectionSpec, bool) {
+	for current := classID; current != 0; current = g.superOf[current] {
+		if spec, ok := collectionSpecs[g.classNames[current]]; ok {
+			return spec, true
+		}
+	}
+	return collectionSpec{}, false
+}
+
+// collectionClassIDs returns all loaded classes that are known collections.
+func (g *heapGraph) collectionClassIDs() []ID {
+	var ids []ID
+	for node, kind := range g.kinds {
+		if kind != KindClass {
+			continue
+		}
+		if _, ok := g.collectionSpecOf(g.ids[node]); ok {
+			ids = append(ids, g.ids[node])
+		}
+	}
+	return ids
+}
+
+// decodeCollection reads size and capacity of a collection instance.
+func (g *heapGraph) decodeCollection(instance InstanceDump) (collectionInfo, bool) {
+	spec, ok := g.collectionSpecOf(instance.ClassObjectID)
+	if !ok {
+		return collectionInfo{}, false
+	}
+	node, ok := g.index[instance.ID]
+	if !ok {
+		return collectionInfo{}, false
+	}
+	fields := g.decodeFields(instance)
+
+	// Wrappers report the state of the wrapped collection under their own name
+	if field, ok := collectionDelegates[spec.kind]; ok {
+		f, ok := findField(fields, field)
+		if !ok {
+			return collectionInfo{}, false
+		}
+		// Without the wrapped collection the size is unknown, the wrapper is not empty
+		inner, ok := loadInstance(f.asID())
+		if !ok {
+			return collectionInfo{}, false
+		}
+		info, ok := g.decodeCollection(inner)
+		info.node = node
+		info.kind = spec.kind
+		info.isMap = spec.isMap
+		info.wrapped = g.index[inner.ID]
+		return info, ok
+	}
+
+	info := collectionInfo{node: node, kind: spec.kind, capacity: -1, isMap: spec.isMap, loadFactor: spec.loadFactor}
+	if f, ok := findField(fields, "loadFactor"); ok && f.Type == Float && len(f.Value) == 4 {
+		if loadFactor := math.Float32frombits(binary.BigEndian.Uint32(f.Value)); loadFactor > 0 {
+			info.loadFactor = float64(loadFactor)
+		}
+	}
+	if spec.sizeField != "" {
+		if f, ok := findField(fields, spec.sizeField); ok {
+			info.size = f.asInt()
+		}
+	}
+	if spec.arrayField == "" {
+		return info, true
+	}
+
+	info.capacity = 0
+	f, ok := findField(fields, spec.arrayField)
+	if !ok {
+		return info, true
+	}
+	backing, ok := g.index[f.asID()]
+	if !ok {
+		return info, true
+	}
+	info.backing = backing
+	info.capacity = int64(g.lengths[backing])
+	info.slotSize = g.model.ReferenceSize
+	if g.kinds[backing] == KindPrimitiveArray {
+		info.slotSize = int64(g.primTypes[backing].GetSize())
+	}
+
+	slots := spec.slotsPerElement
+	if spec.kind == "StringBuilder" {
+		// JDK 9+ keeps UTF16 content in byte[] using two bytes per char
+		if coder, ok := findField(fields, "coder"); ok && coder.asInt() == coderUTF16 {
+			slots = 2
+		}
+	}
+	if slots > 1 {
+		info.capacity /= slots
+		info.slotSize *= slots
+	}
+
+	switch spec.kind {
+	case "CopyOnWriteArrayList":
+		info.size = info.capacity
+	case "ArrayDeque":
+		head, _ := findField(fields, "head")
+		tail, _ := findField(fields, "tail")
+		if info.capacity > 0 {
+			info.size = ((tail.asInt()-head.asInt())%info.capacity + info.capacity) % info.capacity
+		}
+	case "ConcurrentHashMap":
+		info.size += g.concurrentCounterCells(fields)
+	}
+	return info, true
+}
+
+// concurrentCounterCells sums ConcurrentHashMap.counterCells that hold part of the map size.
+func (g *heapGraph) concurrentCounterCells(fields []FieldValue) int64 {
+	f, ok := findField(fields, "counterCells")
+	if !ok || f.asID() == 0 {
+		return 0
+	}
+	var cellIDs []ID
+	if err := GetDB().Model(&ObjectArrayElement{}).
+		Where("\"ObjectArrayDumpID\" = ? AND \"InstanceDumpID\" <> 0", f.asID()).
+		Pluck("\"InstanceDumpID\"", &cellIDs).Error; err != nil {
+		return 0
+	}
+	var sum int64
+	for _, id := range cellIDs {
+		if cell, ok := loadInstance(id); ok {
+			if value, ok := findField(g.decodeFields(cell), "value"); ok {
+				sum += value.asInt()
+			}
+		}
+	}
+	return sum
+}
+
+// decodeAllCollections decodes every instance of a known collection class.
+func (g *heapGraph) decodeAllCollections() ([]collectionInfo, error) {
+	var decoded []collectionInfo
+	wrapped := make(map[int32]bool)
+	err := forEachInstance(g.collectionClassIDs(), func(instance InstanceDump) {
+		if info, ok := g.decodeCollection(instance); ok {
+			decoded = append(decoded, info)
+			if info.wrapped != 0 {
+				wrapped[info.wrapped] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting collections: %w", err)
+	}
+
+	// The map inside HashSet is reported as part of the set, not on its own
+	collections := decoded[:0]
+	for _, info := range decoded {
+		if !wrapped[info.node] {
+			collections = append(collections, info)
+		}
+	}
+	return collections, nil
+}
+
+// AnalyzeCollectionFillRatio reports size against capacity of JDK collections,
+// empty and sparse instances and the owner fields wasting most of the slots.
+func AnalyzeCollectionFillRatio(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nCollection fill ratio (top %d owners)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	collections, err := g.decodeAllCollections()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding collections: %v\n", err))
+		return result
+	}
+
+	type kindStats struct {
+		kind     string
+		count    int64
+		empty    int64
+		sparse   int64
+		elements int64
+		slots    int64
+		wasted   int64
+	}
+	var wasteful []int32
+	for _, c := range collections {
+		if c.wastedBytes() > 0 {
+			wasteful = append(wasteful, c.node)
+		}
+	}
+	fields, err := g.loadReferrers(wasteful)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	byKind := make(map[string]*kindStats)
+	wastedByOwner := make(map[string]int64)
+	for _, c := range collections {
+		stats, ok := byKind[c.kind]
+		if !ok {
+			stats = &kindStats{kind: c.kind}
+			byKind[c.kind] = stats
+		}
+		stats.count++
+		stats.elements += c.size
+		if c.size == 0 {
+			stats.empty++
+		}
+		if c.capacity > 0 {
+			stats.slots += c.capacity
+			if c.size > 0 && c.size*4 < c.capacity {
+				stats.sparse++
+			}
+		}
+		stats.wasted += c.wastedBytes()
+
+		if c.wastedBytes() > 0 {
+			for _, key := range g.ownerKeys(c.node, fields) {
+				wastedByOwner[c.kind+" in "+key] += c.wastedBytes()
+			}
+		}
+	}
+
+	kinds := make([]*kindStats, 0, len(byKind))
+	for _, stats := range byKind {
+		kinds = append(kinds, stats)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].wasted != kinds[j].wasted {
+			return kinds[i].wasted > kinds[j].wasted
+		}
+		return kinds[i].kind < kinds[j].kind
+	})
+
+	if len(kinds) == 0 {
+		result.Body = append(result.Body, "No collections found\n")
+		return result
+	}
+
+	result.Body = append(result.Body, "By collection type (sparse means less than 25% of slots are used):\n")
+	for i, stats := range kinds {
+		fill := "n/a"
+		if stats.slots > 0 {
+			fill = fmt.Sprintf("%.1f%%", percentOf(stats.elements, stats.slots))
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Count: %d, Empty: %d, Sparse: %d, Elements: %d, Fill: %s, Wasted: %d bytes\n",
+			i+1, stats.kind, stats.count, stats.empty, stats.sparse, stats.elements, fill, stats.wasted))
+	}
+
+	if len(wastedByOwner) > 0 {
+		result.Body = append(result.Body, "\nOwner fields wasting most slots:\n")
+		for i, owner := range topCounts(wastedByOwner, max) {
+			result.Body = append(result.Body, fmt.Sprintf("%d. %s: %d bytes\n", i+1, owner.key, owner.count))
+		}
+	}
+	return result
+}
+
+// AnalyzeEmptyCollections finds collections without elements, groups them by the field
+// holding them and estimates the memory lazy initialization of these fields would save.
+func AnalyzeEmptyCollections(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d owners of empty collections\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	collections, err := g.decodeAllCollections()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding collections: %v\n", err))
+		return result
+	}
+	dom := g.dominators()
+	var empty []int32
+	for _, c := range collections {
+		if c.size == 0 {
+			empty = append(empty, c.node)
+		}
+	}
+	fields, err := g.loadReferrers(empty)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	type ownerStats struct {
+		key   string
+		count int64
+		saved int64
+		kinds map[string]int64
+	}
+	byOwner := make(map[string]*ownerStats)
+	var emptyCount, totalSaved int64
+	for _, c := range collections {
+		if c.size != 0 {
+			continue
+		}
+		// The retained size covers the collection with its backing array and wrapped map,
+		// objects shared with others stay alive and are not counted
+		saved := g.sizes[c.node]
+		if dom.isReachable(c.node) {
+			saved = dom.retained[c.node]
+		}
+		emptyCount++
+		totalSaved += saved
+
+		keys := g.ownerKeys(c.node, fields)
+		if len(keys) == 0 {
+			keys = []string{"<unreferenced>"}
+		}
+		for _, key := range keys {
+			stats, ok := byOwner[key]
+			if !ok {
+				stats = &ownerStats{key: key, kinds: make(map[string]int64)}
+				byOwner[key] = stats
+			}
+			stats.count++
+			stats.saved += saved
+			stats.kinds[c.kind]++
+		}
+	}
+
+	result.Body = append(result.Body, fmt.Sprintf("Collections: %d, empty: %d, lazy initialization would save: %d bytes\n\n",
+		len(collections), emptyCount, totalSaved))
+	if emptyCount == 0 {
+		return result
+	}
+
+	owners := make([]*ownerStats, 0, len(byOwner))
+	for _, stats := range byOwner {
+		owners = append(owners, stats)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].saved != owners[j].saved {
+			return owners[i].saved > owners[j].saved
+		}
+		return owners[i].key < owners[j].key
+	})
+	for i, owner := range owners {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Empty: %d, Saved: %d bytes, Types: %s\n",
+			i+1, owner.key, owner.count, owner.saved, formatCounts(topCounts(owner.kinds, 3))))
+	}
+	return result
+}
@@ -35,11 +35,13 @@ func InitDB() error {
 
 	// Auto migrate all tables
 	tables := []interface{}{
+		&HprofHeader{},
 		&StringInUTF8{},
 		&LoadClass{},
 		&UnloadClass{},
 		&StackTrace{},
 		&StackFrame{},
+		&StartThread{},
 		&AllocSites{},
 		&Site{},
 		&RootUnknown{},
@@ -81,6 +83,10 @@ func IsDBInitialized() bool {
 	return db != nil
 }
 
+func SaveHprofHeader(h *HprofHeader) error {
+	return db.Create(h).Error
+}
+
 func SaveStringInUTF8(s *StringInUTF8) error {
 	return db.Create(s).Error
 }
@@ -101,6 +107,10 @@ func SaveStackFrame(sf *StackFrame) error {
 	return db.Create(sf).Error
 }
 
+func SaveStartThread(st *StartThread) error {
+	return db.Create(st).Error
+}
+
 func SaveAllocSites(as *AllocSites) error {
 	return db.Create(as).Error
 }
@@ -0,0 +1,225 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dominatorTree holds immediate dominators and retained sizes of every node reachable from node 0.
+// Unreachable nodes have idom == -1 and zero retained size.
+type dominatorTree struct {
+	idom     []int32
+	retained []int64
+	order    []int32 // reverse postorder of reachable nodes, starts with node 0
+
+	children [][]int32
+}
+
+// computeDominators builds the dominator tree of the graph rooted at node 0
+// using the iterative algorithm of Cooper, Harvey and Kennedy.
+func computeDominators(out [][]int32, sizes []int64) *dominatorTree {
+	n := len(out)
+	tree := &dominatorTree{
+		idom:     make([]int32, n),
+		retained: make([]int64, n),
+	}
+	if n == 0 {
+		return tree
+	}
+
+	// Iterative DFS to get postorder numbers, recursion would overflow on long chains
+	postorder := make([]int32, 0, n)
+	visited := make([]bool, n)
+	type frame struct {
+		node int32
+		next int
+	}
+	stack := []frame{{node: 0}}
+	visited[0] = true
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next < len(out[top.node]) {
+			child := out[top.node][top.next]
+			top.next++
+			if !visited[child] {
+				visited[child] = true
+				stack = append(stack, frame{node: child})
+			}
+			continue
+		}
+		postorder = append(postorder, top.node)
+		stack = stack[:len(stack)-1]
+	}
+
+	rpoNumber := make([]int32, n)
+	for i := range rpoNumber {
+		rpoNumber[i] = -1
+	}
+	tree.order = make([]int32, len(postorder))
+	for i, node := range postorder {
+		pos := len(postorder) - 1 - i
+		tree.order[pos] = node
+		rpoNumber[node] = int32(pos)
+	}
+
+	preds := make([][]int32, n)
+	for from, targets := range out {
+		if !visited[from] {
+			continue
+		}
+		for _, to := range targets {
+			preds[to] = append(preds[to], int32(from))
+		}
+	}
+
+	for i := range tree.idom {
+		tree.idom[i] = -1
+	}
+	tree.idom[0] = 0
+
+	intersect := func(a, b int32) int32 {
+		for a != b {
+			for rpoNumber[a] > rpoNumber[b] {
+				a = tree.idom[a]
+			}
+			for rpoNumber[b] > rpoNumber[a] {
+				b = tree.idom[b]
+			}
+		}
+		return a
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, node := range tree.order[1:] {
+			newIdom := int32(-1)
+			for _, p := range preds[node] {
+				if tree.idom[p] == -1 {
+					continue
+				}
+				if newIdom == -1 {
+					newIdom = p
+				} else {
+					newIdom = intersect(p, newIdom)
+				}
+			}
+			if newIdom != -1 && tree.idom[node] != newIdom {
+				tree.idom[node] = newIdom
+				changed = true
+			}
+		}
+	}
+
+	// Children always come after their dominator in reverse postorder
+	for _, node := range tree.order {
+		tree.retained[node] = sizes[node]
+	}
+	for i := len(tree.order) - 1; i > 0; i-- {
+		node := tree.order[i]
+		tree.retained[tree.idom[node]] += tree.retained[node]
+	}
+
+	return tree
+}
+
+func (t *dominatorTree) isReachable(node int32) bool {
+	return t.idom[node] != -1
+}
+
+// dominated returns nodes immediately dominated by the given node, largest retained size first.
+func (t *dominatorTree) dominated(node int32) []int32 {
+	if t.children == nil {
+		t.children = make([][]int32, len(t.idom))
+		for _, v := range t.order[1:] {
+			t.children[t.idom[v]] = append(t.children[t.idom[v]], v)
+		}
+		for _, list := range t.children {
+			sort.Slice(list, func(i, j int) bool {
+				return t.retained[list[i]] > t.retained[list[j]]
+			})
+		}
+	}
+	return t.children[node]
+}
+
+// retainedByClass sums retained sizes per class without counting objects
+// dominated by another instance of the same class twice.
+func (g *heapGraph) retainedByClass() map[ID]*ClassStats {
+	dom := g.dominators()
+	stats := make(map[ID]*ClassStats)
+
+	// classOnPath[c] > 0 while an instance of c is an ancestor in the dominator tree
+	classOnPath := make(map[ID]int)
+	type frame struct {
+		node  int32
+		next  int
+		class ID
+	}
+	stack := []frame{{node: 0}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		children := dom.dominated(top.node)
+		if top.next < len(children) {
+			child := children[top.next]
+			top.next++
+
+			class := g.classes[child]
+			if g.kinds[child] == KindClass || g.kinds[child] == KindPrimitiveArray {
+				class = 0
+			}
+			if class != 0 {
+				s, ok := stats[class]
+				if !ok {
+					s = &ClassStats{ClassName: g.className(class)}
+					stats[class] = s
+				}
+				s.InstanceCount++
+				s.ShallowSize += g.sizes[child]
+				if classOnPath[class] == 0 {
+					s.TotalSize += dom.retained[child]
+				}
+				classOnPath[class]++
+			}
+			stack = append(stack, frame{node: child, class: class})
+			continue
+		}
+		if top.class != 0 {
+			classOnPath[top.class]--
+		}
+		stack = stack[:len(stack)-1]
+	}
+
+	return stats
+}
+
+func PrintTopRetainedObjects(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d objects by retained size\n", max),
+		Body:   make([]string, 0, max),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	dom := g.dominators()
+
+	nodes := make([]int32, 0, len(dom.order))
+	for _, node := range dom.order[1:] {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return dom.retained[nodes[i]] > dom.retained[nodes[j]]
+	})
+
+	result.Body = append(result.Body, fmt.Sprintf("Total reachable heap: %d bytes\n", dom.retained[0]))
+	for i, node := range nodes {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s, Shallow: %d, Retained: %d\n",
+			i+1, g.describeNode(node), g.sizes[node], dom.retained[node]))
+	}
+	return result
+}
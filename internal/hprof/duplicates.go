@@ -0,0 +1,344 @@
+package hprof
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type keyCount struct {
+	key   string
+	count int64
+}
+
+// topCounts sorts the counters in descending order and keeps at most max of them.
+func topCounts(counts map[string]int64, max int) []keyCount {
+	result := make([]keyCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, keyCount{key, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].key < result[j].key
+	})
+	if max >= 0 && len(result) > max {
+		result = result[:max]
+	}
+	return result
+}
+
+// countKeys counts occurrences of every key.
+func countKeys(keys []string) map[string]int64 {
+	counts := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		counts[key]++
+	}
+	return counts
+}
+
+func formatCounts(counts []keyCount) string {
+	parts := make([]string, 0, len(counts))
+	for _, c := range counts {
+		parts = append(parts, fmt.Sprintf("%s (%d)", c.key, c.count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// duplicateGroup is a set of objects with identical content.
+type duplicateGroup struct {
+	title  string
+	nodes  []int32
+	wasted int64
+}
+
+// AnalyzeDuplicateStrings groups java.lang.String instances by value and reports
+// the values wasting most memory together with the fields that hold them.
+func AnalyzeDuplicateStrings(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d duplicated strings\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	if err := g.loadAllStrings(); err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding strings: %v\n", err))
+		return result
+	}
+
+	byValue := make(map[string][]int32)
+	for node, value := range g.stringValues {
+		byValue[value] = append(byValue[value], node)
+	}
+
+	var groups []duplicateGroup
+	var totalWasted, totalDuplicates int64
+	for value, nodes := range byValue {
+		if len(nodes) < 2 {
+			continue
+		}
+		// Strings may already share the backing array, such arrays are counted once
+		var size int64
+		arrays := make(map[int32]bool)
+		for _, node := range nodes {
+			size += g.sizes[node]
+			if array, ok := g.stringArrays[node]; ok && !arrays[array] {
+				arrays[array] = true
+				size += g.sizes[array]
+			}
+		}
+		wasted := size - size/int64(len(nodes))
+		groups = append(groups, duplicateGroup{title: quoteJavaString(value), nodes: nodes, wasted: wasted})
+		totalWasted += wasted
+		totalDuplicates += int64(len(nodes) - 1)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].wasted != groups[j].wasted {
+			return groups[i].wasted > groups[j].wasted
+		}
+		return groups[i].title < groups[j].title
+	})
+
+	result.Body = append(result.Body, fmt.Sprintf("Strings: %d, distinct values: %d, duplicates: %d, wasted: %d bytes\n\n",
+		len(g.stringValues), len(byValue), totalDuplicates, totalWasted))
+
+	var shown []int32
+	for i, group := range groups {
+		if i == max {
+			break
+		}
+		shown = append(shown, group.nodes...)
+	}
+	fields, err := g.loadReferrers(shown)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	ownersTotal := make(map[string]int64)
+	for i, group := range groups {
+		if i == max {
+			break
+		}
+		owners := make(map[string]int64)
+		for _, node := range group.nodes {
+			for _, key := range g.ownerKeys(node, fields) {
+				owners[key]++
+				ownersTotal[key]++
+			}
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. Count: %d, Wasted: %d bytes, Value: %s\n",
+			i+1, len(group.nodes), group.wasted, group.title))
+		if len(owners) > 0 {
+			result.Body = append(result.Body, fmt.Sprintf("   Held by: %s\n", formatCounts(topCounts(owners, 3))))
+		}
+	}
+
+	if len(ownersTotal) > 0 {
+		result.Body = append(result.Body, "\nFields holding most of the duplicates above:\n")
+		for i, owner := range topCounts(ownersTotal, max) {
+			result.Body = append(result.Body, fmt.Sprintf("%d. %s: %d strings\n", i+1, owner.key, owner.count))
+		}
+	}
+	return result
+}
+
+// arrayOwnerKey formats an owner found by findArrayOwners the same way as heapGraph.ownerKey.
+func arrayOwnerKey(owner ArrayOwnerInfo) string {
+	switch owner.OwnerType {
+	case "StaticField":
+		return owner.OwnerClass + ".static " + owner.FieldName
+	case "ArrayElement":
+		return owner.OwnerClass + "[*]"
+	}
+	return owner.OwnerClass + "." + owner.FieldName
+}
+
+// arrayHashes accumulates content hashes of primitive arrays from their element rows.
+type arrayHashes struct {
+	hashers map[ID]hash.Hash
+	lengths map[ID]int
+}
+
+func newArrayHashes() *arrayHashes {
+	return &arrayHashes{hashers: make(map[ID]hash.Hash), lengths: make(map[ID]int)}
+}
+
+// add appends an element row, rows of one array must come in index order.
+func (a *arrayHashes) add(element PrimitiveArrayElement) {
+	h, ok := a.hashers[element.PrimitiveArrayDumpID]
+	if !ok {
+		h = sha256.New()
+		a.hashers[element.PrimitiveArrayDumpID] = h
+	}
+	h.Write(element.Value)
+	a.lengths[element.PrimitiveArrayDumpID] += len(element.Value)
+}
+
+// sums returns hashes of primitive arrays of the graph whose elements were all added.
+func (a *arrayHashes) sums(g *heapGraph) map[int32][sha256.Size]byte {
+	hashes := make(map[int32][sha256.Size]byte)
+	empty := sha256.Sum256(nil)
+	for node, kind := range g.kinds {
+		if kind != KindPrimitiveArray {
+			continue
+		}
+		id := g.ids[node]
+		expected := int(g.lengths[node] * g.primTypes[node].GetSize())
+		h, ok := a.hashers[id]
+		switch {
+		case !ok && expected == 0:
+			hashes[int32(node)] = empty
+		case ok && a.lengths[id] == expected:
+			var sum [sha256.Size]byte
+			copy(sum[:], h.Sum(nil))
+			hashes[int32(node)] = sum
+		}
+		// Arrays too large to be stored element by element can not be compared
+	}
+	return hashes
+}
+
+// hashPrimitiveArrays computes content hashes of all primitive arrays stored element by element.
+func hashPrimitiveArrays(g *heapGraph) (map[int32][sha256.Size]byte, error) {
+	hashes := newArrayHashes()
+
+	// Rows are inserted array by array, so reading them by primary key keeps element order
+	var batch []PrimitiveArrayElement
+	err := GetDB().FindInBatches(&batch, 10000, func(tx *gorm.DB, _ int) error {
+		for _, element := range batch {
+			hashes.add(element)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("error reading primitive array elements: %w", err)
+	}
+	return hashes.sums(g), nil
+}
+
+// duplicateArrayGroups groups arrays with the same type, length and content hash, every copy
+// but the first is wasted. Groups wasting most come first.
+func (g *heapGraph) duplicateArrayGroups(hashes map[int32][sha256.Size]byte) (groups []duplicateGroup, totalWasted int64) {
+	type contentKey struct {
+		elemType BasicType
+		length   int32
+		sum      [sha256.Size]byte
+	}
+	byContent := make(map[contentKey][]int32)
+	for node, sum := range hashes {
+		key := contentKey{g.primTypes[node], g.lengths[node], sum}
+		byContent[key] = append(byContent[key], node)
+	}
+
+	for key, nodes := range byContent {
+		if len(nodes) < 2 {
+			continue
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+		wasted := int64(len(nodes)-1) * g.sizes[nodes[0]]
+		groups = append(groups, duplicateGroup{
+			title:  fmt.Sprintf("%s[%d]", key.elemType.GetName(), key.length),
+			nodes:  nodes,
+			wasted: wasted,
+		})
+		totalWasted += wasted
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].wasted != groups[j].wasted {
+			return groups[i].wasted > groups[j].wasted
+		}
+		return groups[i].nodes[0] < groups[j].nodes[0]
+	})
+	return groups, totalWasted
+}
+
+// AnalyzeDuplicateArrays groups primitive arrays with identical type and content
+// and reports the groups wasting most memory together with their owners.
+func AnalyzeDuplicateArrays(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d duplicated primitive arrays\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+
+	hashes, err := hashPrimitiveArrays(g)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error hashing arrays: %v\n", err))
+		return result
+	}
+
+	groups, totalWasted := g.duplicateArrayGroups(hashes)
+	result.Body = append(result.Body, fmt.Sprintf("Compared arrays: %d, duplicate groups: %d, wasted: %d bytes\n\n",
+		len(hashes), len(groups), totalWasted))
+	if len(groups) > max {
+		groups = groups[:max]
+	}
+	if len(groups) == 0 {
+		result.Body = append(result.Body, "No duplicated arrays found\n")
+		return result
+	}
+
+	// Owners are resolved the same way as in AnalyzeArrayOwners, graph referrers are used as a fallback
+	minElements := g.lengths[groups[0].nodes[0]]
+	for _, group := range groups {
+		if length := g.lengths[group.nodes[0]]; length < minElements {
+			minElements = length
+		}
+	}
+	owners, errs := findArrayOwners(int(minElements))
+	for _, err := range errs {
+		result.Body = append(result.Body, err.Error()+"\n")
+	}
+	ownersOf := make(map[ID][]string)
+	for _, owner := range owners {
+		ownersOf[owner.ArrayID] = append(ownersOf[owner.ArrayID], arrayOwnerKey(owner))
+	}
+
+	var unowned []int32
+	for _, group := range groups {
+		for _, node := range group.nodes {
+			if _, ok := ownersOf[g.ids[node]]; !ok {
+				unowned = append(unowned, node)
+			}
+		}
+	}
+	fields, err := g.loadReferrers(unowned)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	for i, group := range groups {
+		counts := make(map[string]int64)
+		for _, node := range group.nodes {
+			keys, ok := ownersOf[g.ids[node]]
+			if !ok {
+				keys = g.ownerKeys(node, fields)
+			}
+			for _, key := range keys {
+				counts[key]++
+			}
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s, Count: %d, Wasted: %d bytes, Example ID: %d\n",
+			i+1, group.title, len(group.nodes), group.wasted, g.ids[group.nodes[0]]))
+		if len(counts) > 0 {
+			result.Body = append(result.Body, fmt.Sprintf("   Held by: %s\n", formatCounts(topCounts(counts, 3))))
+		}
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// FieldValue is a decoded field of an InstanceDump.
+type FieldValue struct {
+	Name  string
+	Class ID // class declaring the field
+	Type  BasicType
+	Value []byte
+}
+
+func (f FieldValue) asID() ID {
+	if f.Type != Object || len(f.Value) < 8 {
+		return 0
+	}
+	return ID(binary.BigEndian.Uint64(f.Value))
+}
+
+// asInt returns integral field values sign extended to int64.
+func (f FieldValue) asInt() int64 {
+	switch len(f.Value) {
+	case 1:
+		return int64(int8(f.Value[0]))
+	case 2:
+		if f.Type == Char {
+			return int64(binary.BigEndian.Uint16(f.Value))
+		}
+		return int64(int16(binary.BigEndian.Uint16(f.Value)))
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(f.Value)))
+	case 8:
+		return int64(binary.BigEndian.Uint64(f.Value))
+	}
+	return 0
+}
+
+// findField returns the first field with the given name, fields of subclasses come first.
+func findField(fields []FieldValue, name string) (FieldValue, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldValue{}, false
+}
+
+// decodeFields splits InstanceDump.Data into fields according to the class layout.
+func (g *heapGraph) decodeFields(instance InstanceDump) []FieldValue {
+	var fields []FieldValue
+	offset := 0
+	for classID := instance.ClassObjectID; classID != 0; classID = g.superOf[classID] {
+		for _, field := range g.layouts[classID] {
+			size := int(field.Type.GetSize())
+			if offset+size > len(instance.Data) {
+				return fields
+			}
+			fields = append(fields, FieldValue{
+				Name:  g.fieldName(field.FieldNameStringID),
+				Class: classID,
+				Type:  field.Type,
+				Value: instance.Data[offset : offset+size],
+			})
+			offset += size
+		}
+	}
+	return fields
+}
+
+// loadInstance reads one instance from the database, tests replace it to decode hand-built objects.
+var loadInstance = func(id ID) (InstanceDump, bool) {
+	var instance InstanceDump
+	if err := GetDB().Where("\"ID\" = ?", id).First(&instance).Error; err != nil {
+		return instance, false
+	}
+	return instance, true
+}
+
+// forEachInstance streams instances of the given classes from the database.
+func forEachInstance(classIDs []ID, fn func(InstanceDump)) error {
+	if len(classIDs) == 0 {
+		return nil
+	}
+	var batch []InstanceDump
+	return GetDB().Where("\"ClassObjectID\" IN ?", classIDs).FindInBatches(&batch, 10000, func(tx *gorm.DB, _ int) error {
+		for _, instance := range batch {
+			fn(instance)
+		}
+		return nil
+	}).Error
+}
+
+// classIDsByName returns class objects with the given name, the same class may be loaded by several loaders.
+func (g *heapGraph) classIDsByName(name string) []ID {
+	var ids []ID
+	for id, className := range g.classNames {
+		if className == name && g.kinds[g.index[id]] == KindClass {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// staticField returns the value of a static field of the class.
+func (g *heapGraph) staticField(classID ID, name string) (FieldValue, bool) {
+	var staticFields []StaticFieldRecord
+	if err := GetDB().Where("\"ClassDumpID\" = ?", classID).Find(&staticFields).Error; err != nil {
+		return FieldValue{}, false
+	}
+	for _, sf := range staticFields {
+		if g.fieldName(sf.StaticFieldNameStringID) == name {
+			return FieldValue{Name: name, Class: classID, Type: sf.Type, Value: sf.Value}, true
+		}
+	}
+	return FieldValue{}, false
+}
+
+// loadPrimitiveArrays reads contents of primitive arrays, the elements are concatenated in index order.
+// Arrays too large to be stored element by element are missing from the result.
+func loadPrimitiveArrays(ids []ID) (map[ID][]byte, error) {
+	result := make(map[ID][]byte, len(ids))
+	const chunkSize = 1000
+	for start := 0; start < len(ids); start += chunkSize {
+		end := start + chunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var elements []PrimitiveArrayElement
+		if err := GetDB().Where("\"PrimitiveArrayDumpID\" IN ?", ids[start:end]).
+			Order("\"PrimitiveArrayDumpID\", \"Index\"").Find(&elements).Error; err != nil {
+			return nil, fmt.Errorf("error getting primitive array elements: %w", err)
+		}
+		for _, element := range elements {
+			result[element.PrimitiveArrayDumpID] = append(result[element.PrimitiveArrayDumpID], element.Value...)
+		}
+
+		// Empty arrays have no element rows
+		var empty []ID
+		if err := GetDB().Model(&PrimitiveArrayDump{}).
+			Where("\"ID\" IN ? AND \"NumberOfElements\" = 0", ids[start:end]).
+			Pluck("\"ID\"", &empty).Error; err != nil {
+			return nil, fmt.Errorf("error getting empty primitive arrays: %w", err)
+		}
+		for _, id := range empty {
+			result[id] = []byte{}
+		}
+	}
+	return result, nil
+}
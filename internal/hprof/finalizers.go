@@ -0,0 +1,197 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	finalizerClass      = "java.lang.ref.Finalizer"
+	referenceQueueClass = "java.lang.ref.ReferenceQueue"
+)
+
+// isFinalizerEdge reports whether the edge goes from a Finalizer to the object awaiting finalization.
+func (g *heapGraph) isFinalizerEdge(from, to int32) bool {
+	if g.kinds[from] != KindInstance {
+		return false
+	}
+	referent, ok := g.referents[from]
+	return ok && referent == to && g.referenceKindOf(g.classes[from]) == finalReference
+}
+
+// enqueuedMarker returns ReferenceQueue.ENQUEUED, references put on a queue point to it.
+func (g *heapGraph) enqueuedMarker() ID {
+	for _, classID := range g.classIDsByName(referenceQueueClass) {
+		if f, ok := g.staticField(classID, "ENQUEUED"); ok {
+			return f.asID()
+		}
+	}
+	return 0
+}
+
+// AnalyzeFinalizers counts objects registered for finalization and already queued for it,
+// groups them by class and computes memory retained only through finalizers.
+// It also lists the fullest reference queues.
+func AnalyzeFinalizers(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nFinalizers and reference queues (top %d)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+
+	type classStats struct {
+		name       string
+		registered int64
+		queued     int64
+		shallow    int64
+		retained   int64 // reachable only through finalizers
+	}
+	byClass := make(map[ID]*classStats)
+	statsOf := func(referent int32) *classStats {
+		class := g.classes[referent]
+		stats, ok := byClass[class]
+		if !ok {
+			stats = &classStats{name: g.nodeClassName(referent)}
+			byClass[class] = stats
+		}
+		return stats
+	}
+
+	enqueued := g.enqueuedMarker()
+	var referents []int32
+	var registered, queued int64
+	err = forEachInstance(g.classIDsByName(finalizerClass), func(instance InstanceDump) {
+		node, ok := g.index[instance.ID]
+		if !ok {
+			return
+		}
+		referent, ok := g.referents[node]
+		if !ok {
+			return
+		}
+		stats := statsOf(referent)
+		stats.registered++
+		stats.shallow += g.sizes[referent]
+		registered++
+		referents = append(referents, referent)
+
+		if f, ok := findField(g.decodeFields(instance), "queue"); ok && enqueued != 0 && f.asID() == enqueued {
+			stats.queued++
+			queued++
+		}
+	})
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error getting finalizers: %v\n", err))
+		return result
+	}
+
+	// Objects that become unreachable without Finalizer.referent are kept only for finalization,
+	// every such object is attributed to the first referent reaching it
+	full := g.reachable(nil)
+	strong := g.reachable(g.isFinalizerEdge)
+	assigned := make(map[int32]bool)
+	var totalRetained, retainedObjects int64
+	sort.Slice(referents, func(i, j int) bool { return referents[i] < referents[j] })
+	for _, referent := range referents {
+		if strong[referent] || !full[referent] || assigned[referent] {
+			continue
+		}
+		stats := statsOf(referent)
+		assigned[referent] = true
+		stack := []int32{referent}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			stats.retained += g.sizes[node]
+			totalRetained += g.sizes[node]
+			retainedObjects++
+			for _, next := range g.out[node] {
+				if !strong[next] && !assigned[next] {
+					assigned[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+	}
+
+	result.Body = append(result.Body, fmt.Sprintf("Registered finalizers: %d, queued for finalization: %d\n", registered, queued))
+	result.Body = append(result.Body, fmt.Sprintf("Retained only through finalizers: %d bytes in %d objects\n", totalRetained, retainedObjects))
+
+	classes := make([]*classStats, 0, len(byClass))
+	for _, stats := range byClass {
+		classes = append(classes, stats)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].retained != classes[j].retained {
+			return classes[i].retained > classes[j].retained
+		}
+		if classes[i].registered != classes[j].registered {
+			return classes[i].registered > classes[j].registered
+		}
+		return classes[i].name < classes[j].name
+	})
+	if len(classes) > 0 {
+		result.Body = append(result.Body, "\nReferents by class:\n")
+	}
+	for i, stats := range classes {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Registered: %d, Queued: %d, Shallow: %d, Retained via finalizers: %d\n",
+			i+1, stats.name, stats.registered, stats.queued, stats.shallow, stats.retained))
+	}
+
+	// ReferenceQueue keeps the number of enqueued references in queueLength
+	type queueInfo struct {
+		node   int32
+		length int64
+	}
+	var queues []queueInfo
+	err = forEachInstance(g.classIDsExtending(referenceQueueClass), func(instance InstanceDump) {
+		node, ok := g.index[instance.ID]
+		if !ok {
+			return
+		}
+		if f, ok := findField(g.decodeFields(instance), "queueLength"); ok && f.asInt() > 0 {
+			queues = append(queues, queueInfo{node, f.asInt()})
+		}
+	})
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error getting reference queues: %v\n", err))
+		return result
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		if queues[i].length != queues[j].length {
+			return queues[i].length > queues[j].length
+		}
+		return queues[i].node < queues[j].node
+	})
+	var shown []int32
+	for i, q := range queues {
+		if i == max {
+			break
+		}
+		shown = append(shown, q.node)
+	}
+	fields, err := g.loadReferrers(shown)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+	result.Body = append(result.Body, fmt.Sprintf("\nNon-empty reference queues: %d\n", len(queues)))
+	for i, q := range queues {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Length: %d\n", i+1, g.describeNode(q.node), q.length))
+		if owners := g.ownerKeys(q.node, fields); len(owners) > 0 {
+			result.Body = append(result.Body, fmt.Sprintf("   Held by: %s\n", formatCounts(topCounts(countKeys(owners), 3))))
+		}
+	}
+	return result
+}
@@ -0,0 +1,588 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ObjectKind describes what kind of heap record a graph node was built from.
+type ObjectKind byte
+
+const (
+	KindSuperRoot ObjectKind = iota
+	KindInstance
+	KindObjectArray
+	KindPrimitiveArray
+	KindClass
+)
+
+// GCRoot is a graph node referenced by one of the root tables.
+type GCRoot struct {
+	Node               int32
+	Type               HeapDumpSubTag
+	ThreadSerialNumber int32
+	FrameNumber        int32
+}
+
+// heapGraph is an in-memory snapshot of the object graph stored in the database.
+// Node 0 is a virtual super root that references every GC root.
+type heapGraph struct {
+	ids       []ID
+	index     map[ID]int32
+	kinds     []ObjectKind
+	classes   []ID        // class object of the node, for classes the class itself
+	primTypes []BasicType // element type of primitive arrays
+	lengths   []int32     // number of elements of arrays
+	sizes     []int64     // shallow sizes
+	out       [][]int32
+	roots     []GCRoot
+	model     SizeModel // layout the shallow sizes are computed with
+
+	classNames map[ID]string
+	fieldNames map[ID]string
+	superOf    map[ID]ID
+	loaderOf   map[ID]ID                    // class loader of every class, 0 for the bootstrap loader
+	layouts    map[ID][]InstanceFieldRecord // own fields of every class
+	refKinds   map[ID]referenceKind
+	referents  map[int32]int32 // java.lang.ref.Reference instance -> referent
+
+	stringValues     map[int32]string
+	stringArrays     map[int32]int32 // filled by loadAllStrings
+	allStringsLoaded bool
+
+	in      [][]int32
+	rootsOf map[int32][]GCRoot
+	dom     *dominatorTree
+
+	excluded map[string]*unreachableStats // objects dropped by GraphOptions.ExcludeUnreachable
+}
+
+type referenceKind byte
+
+const (
+	notReference referenceKind = iota
+	strongReference
+	softReference
+	weakReference
+	phantomReference
+	finalReference
+)
+
+// isWeak reports whether the referent of such reference does not keep it alive.
+func (k referenceKind) isWeak() bool {
+	return k == softReference || k == weakReference || k == phantomReference
+}
+
+// GraphOptions change how the object graph is built for all graph based analyses.
+type GraphOptions struct {
+	// IgnoreWeakReferences drops referent edges of weak, soft and phantom references,
+	// so such referents are not counted in paths, dominators and retained sizes.
+	IgnoreWeakReferences bool
+	// ExcludeUnreachable drops objects not reachable from GC roots, they are garbage
+	// left in dumps taken without a forced GC. Analyses reading objects from the database
+	// directly skip them with reachableFilter.
+	ExcludeUnreachable bool
+}
+
+var (
+	cachedGraph  *heapGraph
+	graphOptions GraphOptions
+)
+
+// SetGraphOptions changes options of the object graph, the cached graph is rebuilt when they differ.
+func SetGraphOptions(options GraphOptions) {
+	if options != graphOptions {
+		graphOptions = options
+		resetHeapGraph()
+	}
+}
+
+// resetHeapGraph drops the cached graph, it must be called when database content changes.
+func resetHeapGraph() {
+	cachedGraph = nil
+	detectedSizeModel = nil
+}
+
+func getHeapGraph() (*heapGraph, error) {
+	if cachedGraph != nil {
+		return cachedGraph, nil
+	}
+	if !IsDBInitialized() {
+		return nil, fmt.Errorf("database is not initialized")
+	}
+	g, err := loadHeapGraph()
+	if err != nil {
+		return nil, err
+	}
+	cachedGraph = g
+	return g, nil
+}
+
+func newHeapGraph() *heapGraph {
+	return &heapGraph{
+		ids:        []ID{0},
+		index:      make(map[ID]int32),
+		kinds:      []ObjectKind{KindSuperRoot},
+		classes:    []ID{0},
+		primTypes:  []BasicType{0},
+		lengths:    []int32{0},
+		sizes:      []int64{0},
+		out:        [][]int32{nil},
+		classNames: make(map[ID]string),
+		fieldNames: make(map[ID]string),
+		superOf:    make(map[ID]ID),
+		loaderOf:   make(map[ID]ID),
+		layouts:    make(map[ID][]InstanceFieldRecord),
+		refKinds:   make(map[ID]referenceKind),
+		referents:  make(map[int32]int32),
+
+		stringValues: make(map[int32]string),
+		stringArrays: make(map[int32]int32),
+	}
+}
+
+func (g *heapGraph) addNode(id ID, kind ObjectKind, class ID, size int64) int32 {
+	if node, ok := g.index[id]; ok {
+		return node
+	}
+	node := int32(len(g.ids))
+	g.ids = append(g.ids, id)
+	g.index[id] = node
+	g.kinds = append(g.kinds, kind)
+	g.classes = append(g.classes, class)
+	g.primTypes = append(g.primTypes, 0)
+	g.lengths = append(g.lengths, 0)
+	g.sizes = append(g.sizes, size)
+	g.out = append(g.out, nil)
+	return node
+}
+
+func (g *heapGraph) addEdge(from int32, to ID) {
+	if to == 0 {
+		return
+	}
+	if node, ok := g.index[to]; ok {
+		g.out[from] = append(g.out[from], node)
+	}
+}
+
+// addFieldEdge adds the edge of an object field of an instance. The referent of a reference is
+// recorded in referents, its edge is dropped for soft, weak and phantom references with IgnoreWeakReferences.
+func (g *heapGraph) addFieldEdge(node int32, refKind referenceKind, field string, ref ID) {
+	isReferent := refKind != notReference && field == "referent"
+	if isReferent {
+		if referent, ok := g.index[ref]; ok {
+			g.referents[node] = referent
+		}
+	}
+	if !isReferent || !refKind.isWeak() || !graphOptions.IgnoreWeakReferences {
+		g.addEdge(node, ref)
+	}
+}
+
+func (g *heapGraph) addRoot(id ID, rootType HeapDumpSubTag, threadSerial int32, frame int32) {
+	node, ok := g.index[id]
+	if !ok {
+		return
+	}
+	g.roots = append(g.roots, GCRoot{Node: node, Type: rootType, ThreadSerialNumber: threadSerial, FrameNumber: frame})
+}
+
+func (g *heapGraph) node(id ID) (int32, bool) {
+	node, ok := g.index[id]
+	return node, ok
+}
+
+func (g *heapGraph) className(classID ID) string {
+	if name, ok := g.classNames[classID]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown class %d", classID)
+}
+
+// nodeClassName returns a human readable type of the node.
+func (g *heapGraph) nodeClassName(node int32) string {
+	switch g.kinds[node] {
+	case KindSuperRoot:
+		return "<GC roots>"
+	case KindClass:
+		return "class " + g.className(g.ids[node])
+	case KindPrimitiveArray:
+		return g.primTypes[node].GetName() + "[]"
+	}
+	return g.className(g.classes[node])
+}
+
+func (g *heapGraph) fieldName(stringID ID) string {
+	if name, ok := g.fieldNames[stringID]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown field %d", stringID)
+}
+
+// describeNode returns the node as ClassName@id, strings are followed by their value.
+func (g *heapGraph) describeNode(node int32) string {
+	if g.kinds[node] == KindSuperRoot {
+		return g.nodeClassName(node)
+	}
+	description := fmt.Sprintf("%s@%d", g.nodeClassName(node), g.ids[node])
+	if g.isStringNode(node) {
+		if value, ok := g.stringValue(node); ok {
+			description += " " + quoteJavaString(value)
+		}
+	}
+	return description
+}
+
+// referenceKindOf finds out whether the class extends java.lang.ref.Reference and how strong it is.
+func (g *heapGraph) referenceKindOf(classID ID) referenceKind {
+	if kind, ok := g.refKinds[classID]; ok {
+		return kind
+	}
+	kind := notReference
+	for current := classID; current != 0; current = g.superOf[current] {
+		switch g.classNames[current] {
+		case "java.lang.ref.SoftReference":
+			kind = softReference
+		case "java.lang.ref.WeakReference":
+			kind = weakReference
+		case "java.lang.ref.PhantomReference":
+			kind = phantomReference
+		case "java.lang.ref.FinalReference":
+			kind = finalReference
+		case "java.lang.ref.Reference":
+			kind = strongReference
+		default:
+			continue
+		}
+		break
+	}
+	g.refKinds[classID] = kind
+	return kind
+}
+
+// isWeakEdge reports whether the edge is the referent of a weak, soft or phantom reference.
+func (g *heapGraph) isWeakEdge(from, to int32) bool {
+	if g.kinds[from] != KindInstance {
+		return false
+	}
+	referent, ok := g.referents[from]
+	return ok && referent == to && g.referenceKindOf(g.classes[from]).isWeak()
+}
+
+func (g *heapGraph) refersTo(from, to int32) bool {
+	for _, node := range g.out[from] {
+		if node == to {
+			return true
+		}
+	}
+	return false
+}
+
+// rootsOfNode returns GC roots pointing to the node.
+func (g *heapGraph) rootsOfNode(node int32) []GCRoot {
+	if g.rootsOf == nil {
+		g.rootsOf = make(map[int32][]GCRoot)
+		for _, root := range g.roots {
+			g.rootsOf[root.Node] = append(g.rootsOf[root.Node], root)
+		}
+	}
+	return g.rootsOf[node]
+}
+
+// fieldLayout returns instance fields in the order they are written to InstanceDump.Data:
+// fields of the class itself first, then fields of its superclasses.
+func (g *heapGraph) fieldLayout(classID ID) []InstanceFieldRecord {
+	var fields []InstanceFieldRecord
+	for classID != 0 {
+		fields = append(fields, g.layouts[classID]...)
+		classID = g.superOf[classID]
+	}
+	return fields
+}
+
+func (g *heapGraph) inbound() [][]int32 {
+	if g.in != nil {
+		return g.in
+	}
+	g.in = make([][]int32, len(g.ids))
+	for from, targets := range g.out {
+		for _, to := range targets {
+			g.in[to] = append(g.in[to], int32(from))
+		}
+	}
+	return g.in
+}
+
+// reachable marks nodes reachable from GC roots, edges accepted by skip are not followed.
+func (g *heapGraph) reachable(skip func(from, to int32) bool) []bool {
+	visited := make([]bool, len(g.ids))
+	visited[0] = true
+	stack := []int32{0}
+	for len(stack) > 0 {
+		from := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, to := range g.out[from] {
+			if visited[to] || (skip != nil && skip(from, to)) {
+				continue
+			}
+			visited[to] = true
+			stack = append(stack, to)
+		}
+	}
+	return visited
+}
+
+func (g *heapGraph) dominators() *dominatorTree {
+	if g.dom == nil {
+		g.dom = computeDominators(g.out, g.sizes)
+	}
+	return g.dom
+}
+
+func loadHeapGraph() (*heapGraph, error) {
+	g := newHeapGraph()
+
+	type classNameRow struct {
+		ClassID   ID     `gorm:"column:class_id"`
+		ClassName string `gorm:"column:class_name"`
+	}
+	var names []classNameRow
+	nameQuery := `
+		SELECT
+			lc."ClassObjectID" as class_id,
+			REPLACE(convert_from(s."Bytes", 'UTF8'), '/', '.') as class_name
+		FROM "LoadClass" lc
+		JOIN "StringInUTF8" s ON lc."ClassNameStringID" = s."StringID"
+	`
+	if err := GetDB().Raw(nameQuery).Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("error getting class names: %w", err)
+	}
+	for _, row := range names {
+		g.classNames[row.ClassID] = row.ClassName
+	}
+
+	var classes []ClassDump
+	if err := GetDB().Find(&classes).Error; err != nil {
+		return nil, fmt.Errorf("error getting classes: %w", err)
+	}
+
+	var staticFields []StaticFieldRecord
+	if err := GetDB().Order("\"ID\"").Find(&staticFields).Error; err != nil {
+		return nil, fmt.Errorf("error getting static fields: %w", err)
+	}
+	staticsOf := make(map[ID][]StaticFieldRecord)
+	for _, sf := range staticFields {
+		staticsOf[sf.ClassDumpID] = append(staticsOf[sf.ClassDumpID], sf)
+	}
+
+	var instanceFields []InstanceFieldRecord
+	if err := GetDB().Order("\"ID\"").Find(&instanceFields).Error; err != nil {
+		return nil, fmt.Errorf("error getting instance fields: %w", err)
+	}
+	for _, f := range instanceFields {
+		g.layouts[f.ClassDumpID] = append(g.layouts[f.ClassDumpID], f)
+	}
+
+	type fieldNameRow struct {
+		StringID ID     `gorm:"column:string_id"`
+		Name     string `gorm:"column:name"`
+	}
+	var fieldNames []fieldNameRow
+	fieldNameQuery := `
+		SELECT s."StringID" as string_id, convert_from(s."Bytes", 'UTF8') as name
+		FROM "StringInUTF8" s
+		WHERE s."StringID" IN (SELECT "FieldNameStringID" FROM "InstanceFieldRecord")
+			OR s."StringID" IN (SELECT "StaticFieldNameStringID" FROM "StaticFieldRecord")
+	`
+	if err := GetDB().Raw(fieldNameQuery).Scan(&fieldNames).Error; err != nil {
+		return nil, fmt.Errorf("error getting field names: %w", err)
+	}
+	for _, row := range fieldNames {
+		g.fieldNames[row.StringID] = row.Name
+	}
+
+	g.model = currentSizeModel()
+	for _, class := range classes {
+		g.addNode(class.ID, KindClass, class.ID, g.model.staticsSize(staticsOf[class.ID]))
+		g.superOf[class.ID] = class.SuperClassObjectID
+		g.loaderOf[class.ID] = class.ClassLoaderObjectID
+	}
+
+	// Register every object first, references are resolved in the second pass
+	var instances []InstanceDump
+	if err := GetDB().Select("\"ID\"", "\"ClassObjectID\"", "\"NumberOfBytes\"").Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("error getting instances: %w", err)
+	}
+	// Instance sizes depend only on the class layout
+	instanceSizes := make(map[ID]int64)
+	for _, instance := range instances {
+		size, ok := instanceSizes[instance.ClassObjectID]
+		if !ok {
+			size = g.model.instanceSize(g.fieldLayout(instance.ClassObjectID))
+			instanceSizes[instance.ClassObjectID] = size
+		}
+		g.addNode(instance.ID, KindInstance, instance.ClassObjectID, size)
+	}
+	instances = nil
+
+	var objectArrays []ObjectArrayDump
+	if err := GetDB().Find(&objectArrays).Error; err != nil {
+		return nil, fmt.Errorf("error getting object arrays: %w", err)
+	}
+	for _, arr := range objectArrays {
+		node := g.addNode(arr.ID, KindObjectArray, arr.ArrayClassObjectID, g.model.arraySize(Object, arr.NumberOfElements))
+		g.lengths[node] = arr.NumberOfElements
+	}
+
+	var primitiveArrays []PrimitiveArrayDump
+	if err := GetDB().Find(&primitiveArrays).Error; err != nil {
+		return nil, fmt.Errorf("error getting primitive arrays: %w", err)
+	}
+	for _, arr := range primitiveArrays {
+		node := g.addNode(arr.ID, KindPrimitiveArray, 0, g.model.arraySize(arr.Type, arr.NumberOfElements))
+		g.primTypes[node] = arr.Type
+		g.lengths[node] = arr.NumberOfElements
+	}
+
+	// Class references: superclass, loader, signers, protection domain and static fields
+	for _, class := range classes {
+		node := g.index[class.ID]
+		g.addEdge(node, class.SuperClassObjectID)
+		g.addEdge(node, class.ClassLoaderObjectID)
+		g.addEdge(node, class.SignersObjectID)
+		g.addEdge(node, class.ProtectionDomainObjectID)
+		for _, sf := range staticsOf[class.ID] {
+			if sf.Type == Object && len(sf.Value) >= 8 {
+				g.addEdge(node, ID(binary.BigEndian.Uint64(sf.Value)))
+			}
+		}
+	}
+
+	var batch []InstanceDump
+	err := GetDB().FindInBatches(&batch, 10000, func(tx *gorm.DB, _ int) error {
+		for _, instance := range batch {
+			node := g.index[instance.ID]
+			g.addEdge(node, instance.ClassObjectID)
+			refKind := g.referenceKindOf(instance.ClassObjectID)
+			offset := 0
+			for _, field := range g.fieldLayout(instance.ClassObjectID) {
+				if field.Type == Object && offset+8 <= len(instance.Data) {
+					ref := ID(binary.BigEndian.Uint64(instance.Data[offset : offset+8]))
+					g.addFieldEdge(node, refKind, g.fieldName(field.FieldNameStringID), ref)
+				}
+				offset += int(field.Type.GetSize())
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("error reading instance references: %w", err)
+	}
+
+	for _, arr := range objectArrays {
+		g.addEdge(g.index[arr.ID], arr.ArrayClassObjectID)
+	}
+	var elements []ObjectArrayElement
+	err = GetDB().Where("\"InstanceDumpID\" <> 0").FindInBatches(&elements, 10000, func(tx *gorm.DB, _ int) error {
+		for _, element := range elements {
+			if node, ok := g.index[element.ObjectArrayDumpID]; ok {
+				g.addEdge(node, element.InstanceDumpID)
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("error reading array elements: %w", err)
+	}
+
+	if err := g.loadRoots(); err != nil {
+		return nil, err
+	}
+	for _, root := range g.roots {
+		g.out[0] = append(g.out[0], root.Node)
+	}
+
+	if graphOptions.ExcludeUnreachable {
+		g = g.withoutUnreachable()
+	}
+	return g, nil
+}
+
+func (g *heapGraph) loadRoots() error {
+	var unknown []RootUnknown
+	if err := GetDB().Find(&unknown).Error; err != nil {
+		return fmt.Errorf("error getting RootUnknown: %w", err)
+	}
+	for _, r := range unknown {
+		g.addRoot(r.ID, RootUnknownTag, 0, 0)
+	}
+
+	var jniGlobals []RootJNIGlobal
+	if err := GetDB().Find(&jniGlobals).Error; err != nil {
+		return fmt.Errorf("error getting RootJNIGlobal: %w", err)
+	}
+	for _, r := range jniGlobals {
+		g.addRoot(r.ID, RootJNIGlobalTag, 0, 0)
+	}
+
+	var jniLocals []RootJNILocal
+	if err := GetDB().Find(&jniLocals).Error; err != nil {
+		return fmt.Errorf("error getting RootJNILocal: %w", err)
+	}
+	for _, r := range jniLocals {
+		g.addRoot(r.ID, RootJNILocalTag, r.ThreadSerialNumber, r.FrameNumberInStackTrace)
+	}
+
+	var javaFrames []RootJavaFrame
+	if err := GetDB().Find(&javaFrames).Error; err != nil {
+		return fmt.Errorf("error getting RootJavaFrame: %w", err)
+	}
+	for _, r := range javaFrames {
+		g.addRoot(r.ObjectID, RootJavaFrameTag, r.ThreadSerialNumber, r.FrameNumberInStackTrace)
+	}
+
+	var nativeStacks []RootNativeStack
+	if err := GetDB().Find(&nativeStacks).Error; err != nil {
+		return fmt.Errorf("error getting RootNativeStack: %w", err)
+	}
+	for _, r := range nativeStacks {
+		g.addRoot(r.ID, RootNativeStackTag, r.ThreadSerialNumber, 0)
+	}
+
+	var stickyClasses []RootStickyClass
+	if err := GetDB().Find(&stickyClasses).Error; err != nil {
+		return fmt.Errorf("error getting RootStickyClass: %w", err)
+	}
+	for _, r := range stickyClasses {
+		g.addRoot(r.ID, RootStickyClassTag, 0, 0)
+	}
+
+	var threadBlocks []RootThreadBlock
+	if err := GetDB().Find(&threadBlocks).Error; err != nil {
+		return fmt.Errorf("error getting RootThreadBlock: %w", err)
+	}
+	for _, r := range threadBlocks {
+		g.addRoot(r.ID, RootThreadBlockTag, r.ThreadSerialNumber, 0)
+	}
+
+	var monitors []RootMonitorUsed
+	if err := GetDB().Find(&monitors).Error; err != nil {
+		return fmt.Errorf("error getting RootMonitorUsed: %w", err)
+	}
+	for _, r := range monitors {
+		g.addRoot(r.ID, RootMonitorUsedTag, 0, 0)
+	}
+
+	var threadObjects []RootThreadObject
+	if err := GetDB().Find(&threadObjects).Error; err != nil {
+		return fmt.Errorf("error getting RootThreadObject: %w", err)
+	}
+	for _, r := range threadObjects {
+		g.addRoot(r.ID, RootThreadObjectTag, r.ThreadSerialNumber, 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// subclasses returns loaded direct subclasses of every class.
+func (g *heapGraph) subclasses() map[ID][]ID {
+	children := make(map[ID][]ID)
+	for class, super := range g.superOf {
+		if super != 0 {
+			children[super] = append(children[super], class)
+		}
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool {
+			if g.classNames[list[i]] != g.classNames[list[j]] {
+				return g.classNames[list[i]] < g.classNames[list[j]]
+			}
+			return list[i] < list[j]
+		})
+	}
+	return children
+}
+
+// classIDsExtending returns loaded classes with the given name and all their subclasses.
+func (g *heapGraph) classIDsExtending(name string) []ID {
+	var ids []ID
+	for node, kind := range g.kinds {
+		if kind != KindClass {
+			continue
+		}
+		for current := g.ids[node]; current != 0; current = g.superOf[current] {
+			if g.classNames[current] == name {
+				ids = append(ids, g.ids[node])
+				break
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// retainedBySet sums retained sizes of the nodes accepted by match,
+// nodes dominated by another accepted node are not counted twice.
+func (g *heapGraph) retainedBySet(match func(node int32) bool) int64 {
+	dom := g.dominators()
+	var total int64
+	stack := []int32{0}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range dom.dominated(node) {
+			if match(child) {
+				total += dom.retained[child]
+			} else {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return total
+}
+
+func (g *heapGraph) formatLayout(classID ID) string {
+	layout := g.layouts[classID]
+	if len(layout) == 0 {
+		return "no fields"
+	}
+	names := make([]string, 0, len(layout))
+	for _, field := range layout {
+		names = append(names, field.Type.GetName()+" "+g.fieldName(field.FieldNameStringID))
+	}
+	return strings.Join(names, ", ")
+}
+
+// PrintClassHierarchy shows the superclass chain with field layout of every level, all loaded
+// subclasses and instance counts and sizes of the class together with its subclasses.
+func PrintClassHierarchy(className string) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nClass hierarchy of %s\n", className),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	classIDs := g.classIDsByName(className)
+	if len(classIDs) == 0 {
+		result.Body = append(result.Body, fmt.Sprintf("Class %s not found\n", className))
+		return result
+	}
+
+	type instanceStats struct {
+		count   int64
+		shallow int64
+	}
+	byClass := make(map[ID]*instanceStats)
+	for node, kind := range g.kinds {
+		if kind != KindInstance && kind != KindObjectArray {
+			continue
+		}
+		stats, ok := byClass[g.classes[node]]
+		if !ok {
+			stats = &instanceStats{}
+			byClass[g.classes[node]] = stats
+		}
+		stats.count++
+		stats.shallow += g.sizes[node]
+	}
+	children := g.subclasses()
+
+	for _, classID := range classIDs {
+		if len(classIDs) > 1 {
+			result.Body = append(result.Body, fmt.Sprintf("\nClass %s@%d\n", className, classID))
+		}
+
+		// Superclass chain from java.lang.Object down to the class
+		var chain []ID
+		for current := classID; current != 0; current = g.superOf[current] {
+			chain = append([]ID{current}, chain...)
+		}
+		result.Body = append(result.Body, "Superclasses and field layout:\n")
+		for depth, current := range chain {
+			result.Body = append(result.Body, fmt.Sprintf("   %s%s: %s\n",
+				strings.Repeat("  ", depth), g.className(current), g.formatLayout(current)))
+		}
+
+		// Subclass tree, the total also covers instances of the class itself
+		hierarchy := map[ID]bool{classID: true}
+		var total instanceStats
+		if stats, ok := byClass[classID]; ok {
+			total = *stats
+		}
+		var lines []string
+		type frame struct {
+			class ID
+			depth int
+		}
+		stack := make([]frame, 0)
+		for i := len(children[classID]) - 1; i >= 0; i-- {
+			stack = append(stack, frame{children[classID][i], 1})
+		}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			hierarchy[top.class] = true
+
+			var stats instanceStats
+			if s, ok := byClass[top.class]; ok {
+				stats = *s
+			}
+			total.count += stats.count
+			total.shallow += stats.shallow
+			lines = append(lines, fmt.Sprintf("   %s%s: Instances: %d, Shallow: %d\n",
+				strings.Repeat("  ", top.depth-1), g.className(top.class), stats.count, stats.shallow))
+
+			subs := children[top.class]
+			for i := len(subs) - 1; i >= 0; i-- {
+				stack = append(stack, frame{subs[i], top.depth + 1})
+			}
+		}
+		result.Body = append(result.Body, fmt.Sprintf("Loaded subclasses (%d):\n", len(lines)))
+		result.Body = append(result.Body, lines...)
+
+		retained := g.retainedBySet(func(node int32) bool {
+			kind := g.kinds[node]
+			return (kind == KindInstance || kind == KindObjectArray) && hierarchy[g.classes[node]]
+		})
+		result.Body = append(result.Body, fmt.Sprintf("Including subclasses: Instances: %d, Shallow: %d, Retained: %d\n",
+			total.count, total.shallow, retained))
+	}
+	return result
+}
@@ -0,0 +1,246 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	primitiveArraysGroup = "<primitive arrays>"
+	defaultPackageGroup  = "<default package>"
+	unnamedModule        = "<unnamed>"
+)
+
+// packageOf returns the package of a class, array classes belong to the package of their elements.
+func packageOf(className string) string {
+	name := strings.TrimLeft(className, "[")
+	if name != className {
+		if len(name) == 1 {
+			return primitiveArraysGroup
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "L"), ";")
+	}
+	for strings.HasSuffix(name, "[]") {
+		name = strings.TrimSuffix(name, "[]")
+	}
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return defaultPackageGroup
+	}
+	return name[:i]
+}
+
+// packagePrefix cuts the package to the first depth components, depth 0 keeps the whole name.
+func packagePrefix(pkg string, depth int) string {
+	if depth <= 0 || strings.HasPrefix(pkg, "<") {
+		return pkg
+	}
+	parts := strings.SplitN(pkg, ".", depth+1)
+	if len(parts) > depth {
+		parts = parts[:depth]
+	}
+	return strings.Join(parts, ".")
+}
+
+// nodePackage returns the package of the object's class, for classes the package of the class itself.
+func (g *heapGraph) nodePackage(node int32) string {
+	switch g.kinds[node] {
+	case KindPrimitiveArray:
+		return primitiveArraysGroup
+	case KindClass:
+		return packageOf(g.className(g.ids[node]))
+	}
+	return packageOf(g.className(g.classes[node]))
+}
+
+// retainedByGroup sums counts, shallow and retained sizes per group without counting objects
+// dominated by another object of the same group twice. Nodes with an empty group are skipped.
+func (g *heapGraph) retainedByGroup(groupOf func(node int32) string) map[string]*ClassStats {
+	dom := g.dominators()
+	stats := make(map[string]*ClassStats)
+
+	onPath := make(map[string]int)
+	type frame struct {
+		node  int32
+		next  int
+		group string
+	}
+	stack := []frame{{node: 0}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		children := dom.dominated(top.node)
+		if top.next < len(children) {
+			child := children[top.next]
+			top.next++
+
+			group := groupOf(child)
+			if group != "" {
+				s, ok := stats[group]
+				if !ok {
+					s = &ClassStats{ClassName: group}
+					stats[group] = s
+				}
+				s.InstanceCount++
+				s.ShallowSize += g.sizes[child]
+				if onPath[group] == 0 {
+					s.TotalSize += dom.retained[child]
+				}
+				onPath[group]++
+			}
+			stack = append(stack, frame{node: child, group: group})
+			continue
+		}
+		if top.group != "" {
+			onPath[top.group]--
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return stats
+}
+
+// stringOf decodes a String object, false for null and undecodable values.
+func (g *heapGraph) stringOf(id ID) (string, bool) {
+	node, ok := g.index[id]
+	if !ok {
+		return "", false
+	}
+	return g.stringValue(node)
+}
+
+// packageModules maps package names to JPMS modules. Packages of the boot, platform and
+// application loaders are in BuiltinClassLoader.packageToModule, other loaders keep
+// NamedPackage objects in ClassLoader.packages. Dumps of JDK 8 have neither.
+func (g *heapGraph) packageModules() (map[string]string, error) {
+	modules := make(map[string]string)
+	// readMap reads a map from package names to objects whose module is found by moduleOf
+	readMap := func(id ID, moduleOf func([]FieldValue) (string, bool)) {
+		instance, ok := loadInstance(id)
+		if !ok {
+			return
+		}
+		view, ok := g.collectionView(instance, -1)
+		if !ok {
+			return
+		}
+		for _, e := range view.entries {
+			pkg, ok := g.stringOf(e.key)
+			if !ok || modules[pkg] != "" {
+				continue
+			}
+			if fields, ok := g.instanceFields(e.value); ok {
+				if module, ok := moduleOf(fields); ok {
+					modules[pkg] = module
+				}
+			}
+		}
+	}
+	// The name of unnamed modules is null
+	nameOf := func(fields []FieldValue) (string, bool) {
+		if name, ok := g.stringOf(refField(fields, "name")); ok {
+			return name, true
+		}
+		return unnamedModule, true
+	}
+
+	for _, classID := range g.classIDsByName("jdk.internal.loader.BuiltinClassLoader") {
+		if f, ok := g.staticField(classID, "packageToModule"); ok {
+			readMap(f.asID(), nameOf)
+		}
+	}
+	err := forEachInstance(g.classIDsExtending("java.lang.ClassLoader"), func(loader InstanceDump) {
+		readMap(refField(g.decodeFields(loader), "packages"), func(pkg []FieldValue) (string, bool) {
+			// java.lang.Package of JDK 8 has no module
+			module, ok := g.instanceFields(refField(pkg, "module"))
+			if !ok {
+				return "", false
+			}
+			return nameOf(module)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading packages of class loaders: %w", err)
+	}
+	return modules, nil
+}
+
+func formatHistogram(stats map[string]*ClassStats, max int) []string {
+	groups := make([]*ClassStats, 0, len(stats))
+	var count, shallow int64
+	for _, s := range stats {
+		groups = append(groups, s)
+		count += s.InstanceCount
+		shallow += s.ShallowSize
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].TotalSize != groups[j].TotalSize {
+			return groups[i].TotalSize > groups[j].TotalSize
+		}
+		return groups[i].ClassName < groups[j].ClassName
+	})
+
+	lines := []string{fmt.Sprintf("Groups: %d, Objects: %d, Shallow: %d bytes\n", len(groups), count, shallow)}
+	for i, s := range groups {
+		if i == max {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s: Count: %d, Shallow: %d (%.1f%%), Retained: %d\n",
+			i+1, s.ClassName, s.InstanceCount, s.ShallowSize, percentOf(s.ShallowSize, shallow), s.TotalSize))
+	}
+	return lines
+}
+
+// PrintPackageHistogram aggregates objects by the first depth components of the package of their
+// class, depth 0 uses whole package names. Up to max packages with the largest retained size are printed.
+func PrintPackageHistogram(depth, max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nHistogram by package (depth %d, top %d)\n", depth, max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	stats := g.retainedByGroup(func(node int32) string {
+		return packagePrefix(g.nodePackage(node), depth)
+	})
+	result.Body = append(result.Body, formatHistogram(stats, max)...)
+	return result
+}
+
+// PrintModuleHistogram aggregates objects by the JPMS module of their class.
+func PrintModuleHistogram(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nHistogram by module (top %d)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	modules, err := g.packageModules()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error: %v\n", err))
+		return result
+	}
+	if len(modules) == 0 {
+		result.Body = append(result.Body, "No module information found, the dump was taken before JDK 9\n")
+		return result
+	}
+	stats := g.retainedByGroup(func(node int32) string {
+		pkg := g.nodePackage(node)
+		if pkg == primitiveArraysGroup {
+			return "java.base"
+		}
+		if module, ok := modules[pkg]; ok {
+			return module
+		}
+		return unnamedModule
+	})
+	result.Body = append(result.Body, formatHistogram(stats, max)...)
+	return result
+}
@@ -1,5 +1,844 @@
 package hprof
 
 import (
+	"encoding/binary"
+	"sort"
 	"testing"
 )
+
+// idBytes encodes object references as instance field data.
+func idBytes(ids ...ID) []byte {
+	b := make([]byte, 0, 8*len(ids))
+	for _, id := range ids {
+		b = binary.BigEndian.AppendUint64(b, uint64(id))
+	}
+	return b
+}
+
+func TestComputeDominators(t *testing.T) {
+	// 0 -> 1, 0 -> 2, 1 -> 3, 2 -> 3, 3 -> 4, 4 -> 3, 5 is unreachable
+	out := [][]int32{
+		{1, 2},
+		{3},
+		{3},
+		{4},
+		{3},
+		{4},
+	}
+	sizes := []int64{0, 10, 20, 30, 40, 50}
+
+	tree := computeDominators(out, sizes)
+
+	wantIdom := []int32{0, 0, 0, 0, 3, -1}
+	for node, want := range wantIdom {
+		if tree.idom[node] != want {
+			t.Errorf("idom[%d] = %d, want %d", node, tree.idom[node], want)
+		}
+	}
+
+	wantRetained := []int64{100, 10, 20, 70, 40, 0}
+	for node, want := range wantRetained {
+		if tree.retained[node] != want {
+			t.Errorf("retained[%d] = %d, want %d", node, tree.retained[node], want)
+		}
+	}
+
+	if children := tree.dominated(0); len(children) != 3 || children[0] != 3 {
+		t.Errorf("dominated(0) = %v, want node 3 first of 3 children", children)
+	}
+}
+
+func TestPathsToRoots(t *testing.T) {
+	// roots: 1 and 2; 1 -> 3 -> 5, 2 -> 4 -> 5, 1 -> 5 via weak reference 6
+	g := newHeapGraph()
+	for id := ID(1); id <= 6; id++ {
+		g.addNode(id, KindInstance, 100, 16)
+	}
+	g.addEdge(g.index[1], 3)
+	g.addEdge(g.index[3], 5)
+	g.addEdge(g.index[2], 4)
+	g.addEdge(g.index[4], 5)
+	g.addEdge(g.index[1], 6)
+	g.addEdge(g.index[6], 5)
+	g.addRoot(1, RootJNIGlobalTag, 0, 0)
+	g.addRoot(2, RootStickyClassTag, 0, 0)
+	g.classNames[100] = "java.lang.ref.WeakReference"
+	g.classes[g.index[6]] = 100
+	g.referents[g.index[6]] = g.index[5]
+
+	paths := g.pathsToRoots(g.index[5], 5, false)
+	if len(paths) != 3 {
+		t.Fatalf("got %d paths, want 3", len(paths))
+	}
+	for _, path := range paths {
+		if len(path) != 3 || path[2] != g.index[5] {
+			t.Errorf("unexpected path %v", path)
+		}
+	}
+
+	paths = g.pathsToRoots(g.index[5], 5, true)
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths without weak references, want 2", len(paths))
+	}
+}
+
+func TestDecodeStringValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		elemType BasicType
+		coder    int64
+		want     string
+	}{
+		{"latin1", []byte{'h', 'e', 'l', 'l', 0xF6}, Byte, coderLatin1, "hellö"},
+		{"utf16 bytes", []byte{0x1F, 0x04, 0x40, 0x04}, Byte, coderUTF16, "Пр"},
+		{"char array", []byte{0x00, 'o', 0x04, 0x3A}, Char, -1, "oк"},
+		{"empty", []byte{}, Byte, coderLatin1, ""},
+	}
+	for _, tt := range tests {
+		if got := decodeStringValue(tt.data, tt.elemType, tt.coder); got != tt.want {
+			t.Errorf("%s: decodeStringValue() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOwnerKeys(t *testing.T) {
+	// instance 1 -> 2 by field cache, array 3 -> 2, class 4 -> 2 by static INSTANCE
+	g := newHeapGraph()
+	g.classNames[100] = "Foo"
+	g.classNames[300] = "Foo[]"
+	g.classNames[4] = "Bar"
+	g.addNode(1, KindInstance, 100, 16)
+	g.addNode(2, KindInstance, 100, 16)
+	g.addNode(3, KindObjectArray, 300, 16)
+	g.addNode(4, KindClass, 4, 0)
+	for _, from := range []ID{1, 3, 4} {
+		g.addEdge(g.index[from], 2)
+	}
+	fields := referrerFields{
+		g.index[1]: {{"<class>", 100}, {"next", 0}, {"cache", 2}},
+		g.index[4]: {{"<super>", 0}, {"static INSTANCE", 2}},
+	}
+
+	keys := g.ownerKeys(g.index[2], fields)
+	sort.Strings(keys)
+	want := []string{"Bar.static INSTANCE", "Foo.cache", "Foo[][*]"}
+	if len(keys) != len(want) {
+		t.Fatalf("ownerKeys() = %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("ownerKeys()[%d] = %s, want %s", i, keys[i], want[i])
+		}
+	}
+	if got := g.ownerKey(g.index[1], g.index[2], nil); got != "Foo.?" {
+		t.Errorf("ownerKey() without fields = %s, want Foo.?", got)
+	}
+}
+
+func TestDuplicateArrayGroups(t *testing.T) {
+	// int[2] arrays 1, 2 and 3 are equal, 4 differs, byte[8] 5 has the bytes of 1,
+	// empty int[] 6 and 7 are equal, int[3] 8 has only one element stored
+	g := newHeapGraph()
+	arrays := []struct {
+		id     ID
+		typ    BasicType
+		length int32
+		size   int64
+		values [][]byte
+	}{
+		{1, Int, 2, 24, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 2}}},
+		{2, Int, 2, 24, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 2}}},
+		{3, Int, 2, 24, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 2}}},
+		{4, Int, 2, 24, [][]byte{{0, 0, 0, 1}, {0, 0, 0, 3}}},
+		{5, Byte, 8, 24, [][]byte{{0}, {0}, {0}, {1}, {0}, {0}, {0}, {2}}},
+		{6, Int, 0, 16, nil},
+		{7, Int, 0, 16, nil},
+		{8, Int, 3, 32, [][]byte{{0, 0, 0, 1}}},
+	}
+	hashes := newArrayHashes()
+	for _, a := range arrays {
+		node := g.addNode(a.id, KindPrimitiveArray, 0, a.size)
+		g.primTypes[node] = a.typ
+		g.lengths[node] = a.length
+		for i, value := range a.values {
+			hashes.add(PrimitiveArrayElement{PrimitiveArrayDumpID: a.id, Index: int32(i), Value: value})
+		}
+	}
+
+	sums := hashes.sums(g)
+	if _, ok := sums[g.index[8]]; ok || len(sums) != 7 {
+		t.Errorf("got %d hashes, want 7 without the incomplete array 8", len(sums))
+	}
+	groups, wasted := g.duplicateArrayGroups(sums)
+	if len(groups) != 2 || wasted != 64 {
+		t.Fatalf("got %d groups wasting %d bytes, want 2 and 64", len(groups), wasted)
+	}
+	if groups[0].title != "int[2]" || len(groups[0].nodes) != 3 || groups[0].wasted != 48 || groups[0].nodes[0] != g.index[1] {
+		t.Errorf("first group = %+v, want 3 int[2] copies wasting 48 bytes", groups[0])
+	}
+	if groups[1].title != "int[0]" || len(groups[1].nodes) != 2 || groups[1].wasted != 16 {
+		t.Errorf("second group = %+v, want 2 empty int arrays wasting 16 bytes", groups[1])
+	}
+}
+
+func TestWastedSlots(t *testing.T) {
+	tests := []struct {
+		info collectionInfo
+		want int64
+	}{
+		{collectionInfo{size: 3, capacity: 10}, 7},
+		{collectionInfo{size: 12, capacity: 16, loadFactor: 0.75}, 0},
+		{collectionInfo{size: 5, capacity: 16, loadFactor: 0.75}, 9},
+		{collectionInfo{size: 0, capacity: -1}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.info.wastedSlots(); got != tt.want {
+			t.Errorf("wastedSlots(size %d, capacity %d, load factor %.2f) = %d, want %d",
+				tt.info.size, tt.info.capacity, tt.info.loadFactor, got, tt.want)
+		}
+	}
+}
+
+func TestCollectionElements(t *testing.T) {
+	// table 1 -> entries 2 and 3, entry 2 -> next entry 4; entries hold boxes 5, 6 and string 7
+	g := newHeapGraph()
+	g.classNames[100] = "java.util.HashMap$Node"
+	g.classNames[200] = "java.lang.Integer"
+	g.classNames[300] = "java.lang.String"
+	g.addNode(1, KindObjectArray, 100, 48)
+	for _, id := range []ID{2, 3, 4} {
+		g.addNode(id, KindInstance, 100, 32)
+	}
+	g.addNode(5, KindInstance, 200, 16)
+	g.addNode(6, KindInstance, 200, 16)
+	g.addNode(7, KindInstance, 300, 24)
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[1], 3)
+	g.addEdge(g.index[2], 5)
+	g.addEdge(g.index[2], 4)
+	g.addEdge(g.index[4], 7)
+	g.addEdge(g.index[3], 6)
+
+	total, boxed := g.collectionElements(collectionInfo{backing: g.index[1], isMap: true}, nil)
+	if len(total) != 3 || len(boxed) != 2 {
+		t.Errorf("got %d elements and %d boxes, want 3 and 2", len(total), len(boxed))
+	}
+
+	total, boxed = g.collectionElements(collectionInfo{backing: g.index[1]}, nil)
+	if len(total) != 2 || len(boxed) != 0 {
+		t.Errorf("list: got %d elements and %d boxes, want 2 and 0", len(total), len(boxed))
+	}
+
+	// HashSet: map 16 with table 10 -> entries 11 and 12 holding boxes 13, 14 and the PRESENT object 15 of HashSet 400
+	g.classNames[400] = "java.util.HashSet"
+	g.classNames[500] = "java.lang.Object"
+	g.classNames[600] = "java.util.HashMap"
+	g.addNode(400, KindClass, 400, 0)
+	g.addNode(16, KindInstance, 600, 48)
+	g.addNode(10, KindObjectArray, 100, 48)
+	g.addEdge(g.index[16], 10)
+	g.addNode(11, KindInstance, 100, 32)
+	g.addNode(12, KindInstance, 100, 32)
+	g.addNode(13, KindInstance, 200, 16)
+	g.addNode(14, KindInstance, 200, 16)
+	g.addNode(15, KindInstance, 500, 16)
+	g.addEdge(g.index[400], 15)
+	g.addEdge(g.index[10], 11)
+	g.addEdge(g.index[10], 12)
+	for _, entry := range []ID{11, 12} {
+		g.addEdge(g.index[entry], 15)
+	}
+	g.addEdge(g.index[11], 13)
+	g.addEdge(g.index[12], 14)
+
+	present := g.setPresentValues()
+	if len(present) != 1 || !present[g.index[15]] {
+		t.Errorf("setPresentValues() = %v, want node of 15", present)
+	}
+	total, boxed = g.collectionElements(collectionInfo{backing: g.index[10], wrapped: g.index[16]}, present)
+	if len(total) != 2 || len(boxed) != 2 {
+		t.Errorf("set: got %d elements and %d boxes, want 2 and 2", len(total), len(boxed))
+	}
+}
+
+func TestDecodeCollectionWithoutWrapped(t *testing.T) {
+	// HashSet 1 refers to map 2 that is not in the dump
+	g := newHeapGraph()
+	g.classNames[100] = "java.util.HashSet"
+	g.fieldNames[1] = "map"
+	g.layouts[100] = []InstanceFieldRecord{{FieldNameStringID: 1, Type: Object}}
+	g.addNode(1, KindInstance, 100, 16)
+
+	saved := loadInstance
+	defer func() { loadInstance = saved }()
+	loadInstance = func(id ID) (InstanceDump, bool) {
+		return InstanceDump{}, false
+	}
+
+	set := InstanceDump{ID: 1, ClassObjectID: 100, Data: []byte{0, 0, 0, 0, 0, 0, 0, 2}}
+	if info, ok := g.decodeCollection(set); ok {
+		t.Errorf("decodeCollection() = %+v, want no collection without the wrapped map", info)
+	}
+}
+
+func TestFormatPrimitive(t *testing.T) {
+	tests := []struct {
+		elemType BasicType
+		value    []byte
+		want     string
+	}{
+		{Boolean, []byte{1}, "true"},
+		{Byte, []byte{0xFF}, "-1"},
+		{Char, []byte{0x04, 0x3A}, "'к'"},
+		{Short, []byte{0x80, 0x00}, "-32768"},
+		{Int, []byte{0x00, 0x00, 0x01, 0x00}, "256"},
+		{Long, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}, "-2"},
+		{Float, []byte{0x3F, 0xC0, 0x00, 0x00}, "1.5"},
+		{Double, []byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}, "3.141592653589793"},
+		{Int, []byte{0x01}, "?"},
+	}
+	for _, tt := range tests {
+		if got := formatPrimitive(tt.elemType, tt.value); got != tt.want {
+			t.Errorf("formatPrimitive(%s, %v) = %s, want %s", tt.elemType.GetName(), tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetainedBySet(t *testing.T) {
+	// root 1 -> 2 -> 3, root 4; nodes 1 and 2 share a class and 2 is dominated by 1
+	g := newHeapGraph()
+	g.addNode(1, KindInstance, 100, 10)
+	g.addNode(2, KindInstance, 100, 20)
+	g.addNode(3, KindInstance, 200, 30)
+	g.addNode(4, KindInstance, 100, 40)
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[2], 3)
+	g.addEdge(0, 1)
+	g.addEdge(0, 4)
+
+	got := g.retainedBySet(func(node int32) bool { return g.classes[node] == 100 })
+	if got != 100 {
+		t.Errorf("retainedBySet() = %d, want 100", got)
+	}
+}
+
+func TestThreadStateName(t *testing.T) {
+	tests := map[int64]string{
+		0:      "NEW",
+		0x0005: "RUNNABLE",
+		0x0401: "BLOCKED",
+		0x0191: "WAITING",
+		0x01A1: "TIMED_WAITING",
+		0x0002: "TERMINATED",
+	}
+	for status, want := range tests {
+		if got := threadStateName(status); got != want {
+			t.Errorf("threadStateName(%#x) = %s, want %s", status, got, want)
+		}
+	}
+}
+
+func TestThreadLocalEntries(t *testing.T) {
+	// thread 1: threadLocals 2 with table 4 = [10, null, 11], inheritableThreadLocals 3 with table 5 = [12];
+	// entry 10 maps ThreadLocal 20 to 30, entry 11 lost its ThreadLocal and keeps 31, entry 12 maps 21 to 32
+	g := newHeapGraph()
+	g.classNames[100] = "java.lang.Thread"
+	g.classNames[200] = "java.lang.ThreadLocal$ThreadLocalMap"
+	g.classNames[300] = "java.lang.ThreadLocal$ThreadLocalMap$Entry"
+	g.classNames[310] = "java.lang.ref.WeakReference"
+	g.classNames[400] = "java.lang.ThreadLocal"
+	g.classNames[500] = "a.Value"
+	g.classNames[600] = "b.Other"
+	names := []string{"name", "threadLocals", "inheritableThreadLocals", "table", "value", "referent"}
+	field := make(map[string]InstanceFieldRecord)
+	for i, name := range names {
+		g.fieldNames[ID(i+1)] = name
+		field[name] = InstanceFieldRecord{FieldNameStringID: ID(i + 1), Type: Object}
+	}
+	g.layouts[100] = []InstanceFieldRecord{field["name"], field["threadLocals"], field["inheritableThreadLocals"]}
+	g.layouts[200] = []InstanceFieldRecord{field["table"]}
+	g.layouts[300] = []InstanceFieldRecord{field["value"]}
+	g.layouts[310] = []InstanceFieldRecord{field["referent"]}
+	g.superOf[300] = 310
+
+	g.addNode(1, KindInstance, 100, 64)
+	g.addNode(2, KindInstance, 200, 24)
+	g.addNode(3, KindInstance, 200, 24)
+	g.lengths[g.addNode(4, KindObjectArray, 300, 32)] = 3
+	g.lengths[g.addNode(5, KindObjectArray, 300, 24)] = 1
+	for _, id := range []ID{10, 11, 12} {
+		g.addNode(id, KindInstance, 300, 32)
+	}
+	g.addNode(20, KindInstance, 400, 16)
+	g.addNode(21, KindInstance, 400, 16)
+	g.addNode(30, KindInstance, 500, 16)
+	g.addNode(31, KindInstance, 500, 16)
+	g.addNode(32, KindInstance, 600, 16)
+
+	instances := map[ID]InstanceDump{
+		2:  {ID: 2, ClassObjectID: 200, Data: idBytes(4)},
+		3:  {ID: 3, ClassObjectID: 200, Data: idBytes(5)},
+		10: {ID: 10, ClassObjectID: 300, Data: idBytes(30, 20)},
+		11: {ID: 11, ClassObjectID: 300, Data: idBytes(31, 0)},
+		12: {ID: 12, ClassObjectID: 300, Data: idBytes(32, 21)},
+	}
+	arrays := map[ID][]ID{4: {10, 0, 11}, 5: {12}}
+	savedInstance, savedArray := loadInstance, loadObjectArray
+	defer func() { loadInstance, loadObjectArray = savedInstance, savedArray }()
+	loadInstance = func(id ID) (InstanceDump, bool) {
+		instance, ok := instances[id]
+		return instance, ok
+	}
+	loadObjectArray = func(id ID, offset, end int) ([]ID, error) {
+		return arrays[id][offset:end], nil
+	}
+
+	entries := g.threadLocalEntries(InstanceDump{ID: 1, ClassObjectID: 100, Data: idBytes(0, 2, 3)})
+	want := []threadLocalEntry{
+		{thread: g.index[1], key: g.index[20], value: g.index[30]},
+		{thread: g.index[1], key: -1, value: g.index[31]},
+		{thread: g.index[1], inheritable: true, key: g.index[21], value: g.index[32]},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	retained := make([]int64, len(g.ids))
+	retained[g.index[30]] = 100
+	retained[g.index[31]] = 40
+	retained[g.index[32]] = 500
+	classes := g.threadLocalClasses(entries, retained)
+	if len(classes) != 2 || classes[0].name != "b.Other" || classes[1].name != "a.Value" {
+		t.Fatalf("unexpected classes %+v", classes)
+	}
+	if value := classes[1]; value.entries != 2 || value.stale != 1 || value.retained != 140 || len(value.threads) != 1 {
+		t.Errorf("a.Value: got %d entries, %d stale, %d bytes, %d threads, want 2, 1, 140 and 1",
+			value.entries, value.stale, value.retained, len(value.threads))
+	}
+
+	sortThreadLocalEntries(entries, retained)
+	for i, value := range []ID{31, 32, 30} {
+		if entries[i].value != g.index[value] {
+			t.Errorf("entry %d holds node %d, want node of %d", i, entries[i].value, value)
+		}
+	}
+}
+
+func TestReachable(t *testing.T) {
+	// root 1 -> 2 -> 3, object 4 is unreachable
+	g := newHeapGraph()
+	for id := ID(1); id <= 4; id++ {
+		g.addNode(id, KindInstance, 100, 8)
+	}
+	g.addEdge(0, 1)
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[2], 3)
+
+	all := g.reachable(nil)
+	if !all[g.index[3]] || all[g.index[4]] {
+		t.Errorf("reachable(nil) = %v", all)
+	}
+	cut := g.reachable(func(from, to int32) bool { return from == g.index[1] })
+	if cut[g.index[2]] || cut[g.index[3]] || !cut[g.index[1]] {
+		t.Errorf("reachable without edges from 1 = %v", cut)
+	}
+}
+
+func TestReferenceEdges(t *testing.T) {
+	// root 1 -> soft 2, weak 3 and finalizer 4; referents 5, 6 and 7, 6 -> 8
+	build := func() *heapGraph {
+		g := newHeapGraph()
+		g.classNames[10] = "java.lang.ref.SoftReference"
+		g.classNames[20] = "java.lang.ref.WeakReference"
+		g.classNames[30] = "java.lang.ref.Finalizer"
+		g.classNames[31] = "java.lang.ref.FinalReference"
+		g.classNames[40] = "A"
+		g.superOf[30] = 31
+		g.addNode(1, KindInstance, 40, 16)
+		g.addNode(2, KindInstance, 10, 32)
+		g.addNode(3, KindInstance, 20, 32)
+		g.addNode(4, KindInstance, 30, 32)
+		g.addNode(5, KindInstance, 40, 100)
+		g.addNode(6, KindInstance, 40, 200)
+		g.addNode(7, KindInstance, 40, 50)
+		g.addNode(8, KindInstance, 40, 10)
+		for _, ref := range []ID{2, 3, 4} {
+			g.addFieldEdge(g.index[1], notReference, "ref", ref)
+		}
+		g.addFieldEdge(g.index[2], g.referenceKindOf(10), "referent", 5)
+		g.addFieldEdge(g.index[3], g.referenceKindOf(20), "referent", 6)
+		g.addFieldEdge(g.index[4], g.referenceKindOf(30), "referent", 7)
+		g.addFieldEdge(g.index[6], notReference, "next", 8)
+		g.addRoot(1, RootJNIGlobalTag, 0, 0)
+		g.addEdge(0, 1)
+		return g
+	}
+
+	g := build()
+	if reachable := g.reachable(nil); !reachable[g.index[5]] || !reachable[g.index[8]] {
+		t.Errorf("referents are not reachable with referent edges")
+	}
+	groups, freedSoft, freedWeak := g.referenceGroups()
+	if freedSoft != 100 || freedWeak != 310 {
+		t.Errorf("freed %d bytes without soft and %d without weak references, want 100 and 310", freedSoft, freedWeak)
+	}
+	if len(groups) != 2 || groups[0].kind != weakReference || groups[1].kind != softReference {
+		t.Fatalf("unexpected groups %+v", groups)
+	}
+	for _, group := range groups {
+		if group.class != "A" || group.references != 1 || group.onlyHere != 1 {
+			t.Errorf("group %+v, want one reference to A reachable only this way", group)
+		}
+	}
+
+	saved := graphOptions
+	defer func() { graphOptions = saved }()
+	graphOptions.IgnoreWeakReferences = true
+	g = build()
+	reachable := g.reachable(nil)
+	for id, want := range map[ID]bool{2: true, 3: true, 4: true, 5: false, 6: false, 7: true, 8: false} {
+		if reachable[g.index[id]] != want {
+			t.Errorf("object %d reachable = %v, want %v", id, reachable[g.index[id]], want)
+		}
+	}
+	if len(g.referents) != 3 {
+		t.Errorf("got %d referents, want 3 recorded without edges", len(g.referents))
+	}
+	groups, freedSoft, freedWeak = g.referenceGroups()
+	if freedSoft != 0 || freedWeak != 0 || len(groups) != 2 || groups[0].onlyHere != 0 || groups[1].onlyHere != 0 {
+		t.Errorf("ignored referents are counted: freed %d and %d, groups %+v", freedSoft, freedWeak, groups)
+	}
+}
+
+func TestWithoutUnreachable(t *testing.T) {
+	// root 1 -> 3, objects 2 -> 3 are garbage
+	g := newHeapGraph()
+	g.addNode(1, KindInstance, 100, 10)
+	g.addNode(2, KindInstance, 100, 20)
+	g.addNode(3, KindInstance, 200, 30)
+	g.classNames[100] = "A"
+	g.addEdge(g.index[1], 3)
+	g.addEdge(g.index[2], 3)
+	g.addRoot(1, RootJNIGlobalTag, 0, 0)
+	g.addEdge(0, 1)
+
+	compact := g.withoutUnreachable()
+	if _, ok := compact.node(2); ok {
+		t.Errorf("unreachable object 2 is kept")
+	}
+	if len(compact.ids) != 3 || len(compact.roots) != 1 || compact.ids[compact.roots[0].Node] != 1 {
+		t.Errorf("unexpected compact graph: ids %v, roots %v", compact.ids, compact.roots)
+	}
+	if out := compact.out[compact.index[1]]; len(out) != 1 || compact.ids[out[0]] != 3 {
+		t.Errorf("edges of object 1 = %v", out)
+	}
+	if s := compact.excluded["A"]; s == nil || s.count != 1 || s.size != 20 {
+		t.Errorf("excluded stats = %+v", compact.excluded)
+	}
+}
+
+func TestReachableOwners(t *testing.T) {
+	// root 1 -> array 3, garbage 2 -> array 3 and 2 -> array 4
+	g := newHeapGraph()
+	g.addNode(1, KindInstance, 100, 16)
+	g.addNode(2, KindInstance, 100, 16)
+	g.addNode(3, KindPrimitiveArray, 0, 64)
+	g.addNode(4, KindPrimitiveArray, 0, 64)
+	g.addEdge(g.index[1], 3)
+	g.addEdge(g.index[2], 3)
+	g.addEdge(g.index[2], 4)
+	g.addRoot(1, RootJNIGlobalTag, 0, 0)
+	g.addEdge(0, 1)
+
+	compact := g.withoutUnreachable()
+	reachable := func(id ID) bool {
+		_, ok := compact.node(id)
+		return ok
+	}
+	owners := []ArrayOwnerInfo{
+		{ArrayID: 3, OwnerID: 1},
+		{ArrayID: 3, OwnerID: 2},
+		{ArrayID: 4, OwnerID: 2},
+	}
+	if kept := reachableOwners(append([]ArrayOwnerInfo(nil), owners...), nil); len(kept) != 3 {
+		t.Errorf("without a filter got %d owners, want 3", len(kept))
+	}
+	kept := reachableOwners(owners, reachable)
+	if len(kept) != 1 || kept[0].ArrayID != 3 || kept[0].OwnerID != 1 {
+		t.Errorf("reachableOwners() = %+v, want array 3 owned by 1", kept)
+	}
+}
+
+func TestSizeModel(t *testing.T) {
+	fields := []InstanceFieldRecord{{Type: Object}, {Type: Int}, {Type: Object}}
+	tests := []struct {
+		model    string
+		instance int64
+		array    int64 // Object[3]
+		bytes    int64 // byte[5]
+	}{
+		{"32bit", 24, 24, 24},
+		{"64bit", 40, 48, 32},
+		{"64bit-ccp", 32, 40, 24},
+		{"64bit-coops", 24, 32, 24},
+		{"lilliput", 24, 24, 24},
+	}
+	for _, tt := range tests {
+		m := SizeModels[tt.model]
+		if got := m.instanceSize(fields); got != tt.instance {
+			t.Errorf("%s: instanceSize() = %d, want %d", tt.model, got, tt.instance)
+		}
+		if got := m.arraySize(Object, 3); got != tt.array {
+			t.Errorf("%s: arraySize(Object, 3) = %d, want %d", tt.model, got, tt.array)
+		}
+		if got := m.arraySize(Byte, 5); got != tt.bytes {
+			t.Errorf("%s: arraySize(Byte, 5) = %d, want %d", tt.model, got, tt.bytes)
+		}
+	}
+
+	// class 2 extends class 1: long and byte of 1 are followed by int and reference of 2
+	hierarchy := []InstanceFieldRecord{
+		{ClassDumpID: 2, Type: Int}, {ClassDumpID: 2, Type: Object},
+		{ClassDumpID: 1, Type: Long}, {ClassDumpID: 1, Type: Byte},
+	}
+	layouts := map[string]int64{
+		// byte fills the gap before the long at 16, class 2 starts at 24
+		"64bit-coops": 32,
+		// header 16, long at 16, byte at 24, class 2 starts at 32: reference at 32, int at 40
+		"64bit": 48,
+		// long at 8, byte at 16, class 2 starts at 20
+		"lilliput": 32,
+	}
+	for name, want := range layouts {
+		if got := SizeModels[name].instanceSize(hierarchy); got != want {
+			t.Errorf("%s: instanceSize() of a hierarchy = %d, want %d", name, got, want)
+		}
+	}
+	if err := SetSizeModel("48bit"); err == nil {
+		t.Errorf("SetSizeModel accepted an unknown model")
+	}
+}
+
+func TestRetainedClasses(t *testing.T) {
+	// root 1 (A) -> 2 (B) -> 3 (B), 1 -> 4 (C)
+	g := newHeapGraph()
+	g.addNode(1, KindInstance, 100, 16)
+	g.addNode(2, KindInstance, 200, 24)
+	g.addNode(3, KindInstance, 200, 24)
+	g.addNode(4, KindInstance, 300, 8)
+	g.classNames[100] = "A"
+	g.classNames[200] = "B"
+	g.classNames[300] = "C"
+	g.addEdge(0, 1)
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[2], 3)
+	g.addEdge(g.index[1], 4)
+
+	lines := g.retainedClasses(g.index[1], 2)
+	want := []string{"     2 objects of B, 48 bytes\n", "     1 objects of A, 16 bytes\n"}
+	if len(lines) != len(want) || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("retainedClasses() = %q, want %q", lines, want)
+	}
+}
+
+func TestLoaderSuspects(t *testing.T) {
+	// webapp loaders 1 and 2 both define app.Foo and app.Bar, 2 has more instances; 3 is in state
+	// STOPPED, 5 is not started, loader 4 of another type is closed and also defines app.Foo
+	g := newHeapGraph()
+	g.classNames[50] = "org.apache.catalina.loader.ParallelWebappClassLoader"
+	g.classNames[60] = "java.net.URLClassLoader"
+	g.classNames[70] = "org.apache.catalina.LifecycleState"
+	g.classNames[90] = javaStringClass
+	names := map[ID]string{100: "app.Foo", 101: "app.Foo", 102: "app.Bar", 103: "app.Bar", 104: "app.Foo", 105: "app.Baz", 106: "app.Qux"}
+	loaders := map[ID]ID{100: 1, 101: 2, 102: 1, 103: 2, 104: 4, 105: 3, 106: 5}
+	for class, name := range names {
+		g.classNames[class] = name
+		g.loaderOf[class] = loaders[class]
+		g.addNode(class, KindClass, 0, 8)
+	}
+	for i, name := range []string{"state", "started", "closed", "name"} {
+		g.fieldNames[ID(i+1)] = name
+	}
+	g.layouts[50] = []InstanceFieldRecord{{FieldNameStringID: 1, Type: Object}, {FieldNameStringID: 2, Type: Boolean}}
+	g.layouts[60] = []InstanceFieldRecord{{FieldNameStringID: 3, Type: Boolean}}
+	g.layouts[70] = []InstanceFieldRecord{{FieldNameStringID: 4, Type: Object}}
+
+	for _, id := range []ID{1, 2, 3, 5} {
+		g.addNode(id, KindInstance, 50, 64)
+	}
+	g.addNode(4, KindInstance, 60, 64)
+	g.addNode(10, KindInstance, 100, 16)
+	g.addNode(11, KindInstance, 101, 16)
+	g.addNode(12, KindInstance, 103, 16)
+	g.addNode(71, KindInstance, 70, 16)
+	g.addNode(72, KindInstance, 70, 16)
+	g.stringValues[g.addNode(81, KindInstance, 90, 24)] = "STOPPED"
+	g.stringValues[g.addNode(82, KindInstance, 90, 24)] = "STARTED"
+
+	instances := map[ID]InstanceDump{
+		1:  {ID: 1, ClassObjectID: 50, Data: append(idBytes(72), 1)},
+		2:  {ID: 2, ClassObjectID: 50, Data: append(idBytes(72), 1)},
+		3:  {ID: 3, ClassObjectID: 50, Data: append(idBytes(71), 1)},
+		4:  {ID: 4, ClassObjectID: 60, Data: []byte{1}},
+		5:  {ID: 5, ClassObjectID: 50, Data: append(idBytes(0), 0)},
+		71: {ID: 71, ClassObjectID: 70, Data: idBytes(81)},
+		72: {ID: 72, ClassObjectID: 70, Data: idBytes(82)},
+	}
+	saved := loadInstance
+	defer func() { loadInstance = saved }()
+	loadInstance = func(id ID) (InstanceDump, bool) {
+		instance, ok := instances[id]
+		return instance, ok
+	}
+
+	info := g.classLoaders()
+	duplicates, sameClasses := g.duplicateClasses(info)
+	if len(duplicates) != 2 || duplicates[0].name != "app.Foo" || len(duplicates[0].classes) != 3 || duplicates[1].name != "app.Bar" {
+		t.Errorf("unexpected duplicates %+v", duplicates)
+	}
+	if len(sameClasses) != 1 || sameClasses[loaderPair{1, 2}] != 2 {
+		t.Errorf("sameClasses = %v, want 2 classes shared by loaders 1 and 2 only", sameClasses)
+	}
+
+	reasons := make(map[ID]string)
+	for _, s := range g.loaderSuspects(info, sameClasses) {
+		reasons[s.loader] = s.reason
+	}
+	want := map[ID]string{
+		1: "redefines 2 classes of org.apache.catalina.loader.ParallelWebappClassLoader@2",
+		3: "marked as state STOPPED",
+		4: "marked as closed",
+		5: "marked as not started",
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("suspects %v, want %v", reasons, want)
+	}
+	for loader, reason := range want {
+		if reasons[loader] != reason {
+			t.Errorf("loader %d: reason %q, want %q", loader, reasons[loader], reason)
+		}
+	}
+}
+
+func TestRingIndexes(t *testing.T) {
+	tests := []struct {
+		head, tail, length int
+		want               []int
+	}{
+		{0, 0, 8, nil},
+		{1, 4, 8, []int{1, 2, 3}},
+		{6, 2, 8, []int{6, 7, 0, 1}},
+		{0, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		got := ringIndexes(tt.head, tt.tail, tt.length)
+		if len(got) != len(tt.want) {
+			t.Errorf("ringIndexes(%d, %d, %d) = %v, want %v", tt.head, tt.tail, tt.length, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ringIndexes(%d, %d, %d) = %v, want %v", tt.head, tt.tail, tt.length, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBufferOwners(t *testing.T) {
+	// array 1 -> buffer 2, array 3 -> view 4 -> buffer 2, cleaner 5 -> buffer 2
+	g := newHeapGraph()
+	g.addNode(1, KindObjectArray, 10, 16)
+	g.addNode(2, KindInstance, 20, 64)
+	g.addNode(3, KindObjectArray, 30, 16)
+	g.addNode(4, KindInstance, 20, 64)
+	g.addNode(5, KindInstance, 40, 40)
+	g.classNames[10] = "A[]"
+	g.classNames[30] = "B[]"
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[3], 4)
+	g.addEdge(g.index[4], 2)
+	g.addEdge(g.index[5], 2)
+	g.referents[g.index[5]] = g.index[2]
+
+	buffers := map[int32]directBuffer{
+		g.index[2]: {node: g.index[2]},
+		g.index[4]: {node: g.index[4], view: true},
+	}
+	keys := g.bufferOwners(g.index[2], buffers, nil, make(map[int32]bool))
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "A[][*]" || keys[1] != "B[][*]" {
+		t.Errorf("bufferOwners() = %v", keys)
+	}
+}
+
+func TestPackageOf(t *testing.T) {
+	tests := map[string]string{
+		"java.util.HashMap":        "java.util",
+		"java.util.HashMap$Node":   "java.util",
+		"[Ljava.lang.String;":      "java.lang",
+		"[[Lcom.example.app.Item;": "com.example.app",
+		"com.example.Item[]":       "com.example",
+		"[[I":                      primitiveArraysGroup,
+		"Main":                     defaultPackageGroup,
+	}
+	for name, want := range tests {
+		if got := packageOf(name); got != want {
+			t.Errorf("packageOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	if got := packagePrefix("com.example.app.model", 2); got != "com.example" {
+		t.Errorf("packagePrefix(depth 2) = %q", got)
+	}
+	if got := packagePrefix("com.example", 5); got != "com.example" {
+		t.Errorf("packagePrefix(depth 5) = %q", got)
+	}
+	if got := packagePrefix(primitiveArraysGroup, 1); got != primitiveArraysGroup {
+		t.Errorf("packagePrefix(primitive arrays) = %q", got)
+	}
+}
+
+func TestRetainedByGroup(t *testing.T) {
+	// root -> 1 (a.X) -> 2 (a.Y) -> 3 (b.Z)
+	g := newHeapGraph()
+	g.addNode(1, KindInstance, 100, 10)
+	g.addNode(2, KindInstance, 200, 20)
+	g.addNode(3, KindInstance, 300, 30)
+	g.classNames[100] = "a.X"
+	g.classNames[200] = "a.Y"
+	g.classNames[300] = "b.Z"
+	g.addEdge(0, 1)
+	g.addEdge(g.index[1], 2)
+	g.addEdge(g.index[2], 3)
+
+	stats := g.retainedByGroup(g.nodePackage)
+	if a := stats["a"]; a == nil || a.InstanceCount != 2 || a.ShallowSize != 30 || a.TotalSize != 60 {
+		t.Errorf("stats of a = %+v", a)
+	}
+	if b := stats["b"]; b == nil || b.InstanceCount != 1 || b.TotalSize != 30 {
+		t.Errorf("stats of b = %+v", b)
+	}
+}
+
+func TestAllocationSiteTypeName(t *testing.T) {
+	tests := []struct {
+		site allocationSite
+		want string
+	}{
+		{allocationSite{ArrayIndicator: NonArray, ClassName: "java.lang.String"}, "java.lang.String"},
+		{allocationSite{ArrayIndicator: Object, ClassName: "java.lang.String"}, "java.lang.String[]"},
+		{allocationSite{ArrayIndicator: Int}, "int[]"},
+	}
+	for _, tt := range tests {
+		if got := tt.site.typeName(); got != tt.want {
+			t.Errorf("typeName() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// formatPrimitive formats a big endian primitive value from the dump.
+func formatPrimitive(t BasicType, value []byte) string {
+	if int32(len(value)) < t.GetSize() {
+		return "?"
+	}
+	switch t {
+	case Boolean:
+		return strconv.FormatBool(value[0] != 0)
+	case Char:
+		return strconv.QuoteRune(rune(binary.BigEndian.Uint16(value)))
+	case Float:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(value))), 'g', -1, 32)
+	case Double:
+		return strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(value)), 'g', -1, 64)
+	}
+	return strconv.FormatInt(FieldValue{Type: t, Value: value}.asInt(), 10)
+}
+
+// formatReference shows a referenced object as ClassName@id.
+func (g *heapGraph) formatReference(id ID) string {
+	if id == 0 {
+		return "null"
+	}
+	node, ok := g.node(id)
+	if !ok {
+		return fmt.Sprintf("@%d (not in dump)", id)
+	}
+	return g.describeNode(node)
+}
+
+func (g *heapGraph) formatValue(t BasicType, value []byte) string {
+	if t == Object {
+		return g.formatReference(FieldValue{Type: t, Value: value}.asID())
+	}
+	return formatPrimitive(t, value)
+}
+
+// inspectInstance lists all instance fields, inherited ones are marked with the declaring class.
+func (g *heapGraph) inspectInstance(node int32) []string {
+	instance, ok := loadInstance(g.ids[node])
+	if !ok {
+		return []string{"Error: instance data not found\n"}
+	}
+	fields := g.decodeFields(instance)
+	lines := []string{fmt.Sprintf("Fields (%d):\n", len(fields))}
+	for _, f := range fields {
+		declared := ""
+		if f.Class != instance.ClassObjectID {
+			declared = " (" + g.className(f.Class) + ")"
+		}
+		lines = append(lines, fmt.Sprintf("   %s %s%s = %s\n", f.Type.GetName(), f.Name, declared, g.formatValue(f.Type, f.Value)))
+	}
+	return lines
+}
+
+// inspectClass lists the class header and static fields.
+func (g *heapGraph) inspectClass(node int32) []string {
+	var class ClassDump
+	if err := GetDB().Where("\"ID\" = ?", g.ids[node]).First(&class).Error; err != nil {
+		return []string{fmt.Sprintf("Error getting class: %v\n", err)}
+	}
+	lines := []string{
+		fmt.Sprintf("Name: %s\n", g.className(class.ID)),
+		fmt.Sprintf("Superclass: %s\n", g.formatReference(class.SuperClassObjectID)),
+		fmt.Sprintf("Class loader: %s\n", g.formatReference(class.ClassLoaderObjectID)),
+		fmt.Sprintf("Instance size: %d bytes (%s), %d bytes of field data in the dump\n",
+			g.model.instanceSize(g.fieldLayout(class.ID)), g.model.label(), class.InstanceSize),
+	}
+
+	var staticFields []StaticFieldRecord
+	if err := GetDB().Where("\"ClassDumpID\" = ?", class.ID).Order("\"ID\"").Find(&staticFields).Error; err != nil {
+		return append(lines, fmt.Sprintf("Error getting static fields: %v\n", err))
+	}
+	lines = append(lines, fmt.Sprintf("Static fields (%d):\n", len(staticFields)))
+	for _, sf := range staticFields {
+		lines = append(lines, fmt.Sprintf("   %s %s = %s\n",
+			sf.Type.GetName(), g.fieldName(sf.StaticFieldNameStringID), g.formatValue(sf.Type, sf.Value)))
+	}
+
+	layout := g.layouts[class.ID]
+	names := make([]string, 0, len(layout))
+	for _, field := range layout {
+		names = append(names, field.Type.GetName()+" "+g.fieldName(field.FieldNameStringID))
+	}
+	lines = append(lines, fmt.Sprintf("Instance fields (%d): %s\n", len(layout), strings.Join(names, ", ")))
+	return lines
+}
+
+// inspectArray prints elements from offset to offset+limit.
+func (g *heapGraph) inspectArray(node int32, offset, limit int) []string {
+	length := int(g.lengths[node])
+	if offset < 0 {
+		offset = 0
+	}
+	end := offset + limit
+	if limit < 0 || end > length {
+		end = length
+	}
+	if offset >= end {
+		return []string{fmt.Sprintf("Length: %d, no elements from index %d\n", length, offset)}
+	}
+	lines := []string{fmt.Sprintf("Elements %d-%d of %d:\n", offset, end-1, length)}
+
+	if g.kinds[node] == KindObjectArray {
+		values, err := loadObjectArray(g.ids[node], offset, end)
+		if err != nil {
+			return append(lines, fmt.Sprintf("Error: %v\n", err))
+		}
+		for i, value := range values {
+			lines = append(lines, fmt.Sprintf("   [%d] %s\n", offset+i, g.formatReference(value)))
+		}
+		return lines
+	}
+
+	var elements []PrimitiveArrayElement
+	if err := GetDB().Where("\"PrimitiveArrayDumpID\" = ? AND \"Index\" >= ? AND \"Index\" < ?", g.ids[node], offset, end).
+		Order("\"Index\"").Find(&elements).Error; err != nil {
+		return append(lines, fmt.Sprintf("Error getting array elements: %v\n", err))
+	}
+	if len(elements) == 0 {
+		return append(lines, "   Array content is not stored in the database\n")
+	}
+	elemType := g.primTypes[node]
+	for _, element := range elements {
+		lines = append(lines, fmt.Sprintf("   [%d] %s\n", element.Index, formatPrimitive(elemType, element.Value)))
+	}
+	return lines
+}
+
+// PrintObject shows a single object: class, sizes, GC roots and decoded fields or array elements.
+// Contents of JDK collections are shown as logical entries. offset and limit select the page
+// of array elements or collection entries.
+func PrintObject(objectID ID, offset, limit int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nObject %d\n", objectID),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	node, ok := g.node(objectID)
+	if !ok {
+		result.Body = append(result.Body, fmt.Sprintf("Object %d not found\n", objectID))
+		return result
+	}
+	dom := g.dominators()
+
+	result.Body = append(result.Body, fmt.Sprintf("Class: %s\n", g.nodeClassName(node)))
+	if g.isStringNode(node) {
+		if value, ok := g.stringValue(node); ok {
+			result.Body = append(result.Body, fmt.Sprintf("Value: %s\n", quoteJavaString(value)))
+		}
+	}
+	result.Body = append(result.Body, fmt.Sprintf("Shallow size: %d bytes\n", g.sizes[node]))
+	if dom.isReachable(node) {
+		result.Body = append(result.Body, fmt.Sprintf("Retained size: %d bytes\n", dom.retained[node]))
+	} else {
+		result.Body = append(result.Body, "Retained size: unreachable from GC roots\n")
+	}
+	if roots := g.rootsOfNode(node); len(roots) > 0 {
+		names := make([]string, 0, len(roots))
+		for _, root := range roots {
+			names = append(names, describeRoot(root))
+		}
+		result.Body = append(result.Body, fmt.Sprintf("GC root: %s\n", strings.Join(names, ", ")))
+	}
+
+	switch g.kinds[node] {
+	case KindInstance:
+		result.Body = append(result.Body, g.inspectInstance(node)...)
+		if instance, ok := loadInstance(objectID); ok {
+			end := offset + limit
+			if limit < 0 {
+				end = -1
+			}
+			if view, ok := g.collectionView(instance, end); ok {
+				result.Body = append(result.Body, g.inspectCollection(view, offset)...)
+			}
+		}
+	case KindClass:
+		result.Body = append(result.Body, g.inspectClass(node)...)
+	case KindObjectArray, KindPrimitiveArray:
+		result.Body = append(result.Body, g.inspectArray(node, offset, limit)...)
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	javaStringClass = "java.lang.String"
+
+	// maxDisplayedStringLength limits string values printed next to objects
+	maxDisplayedStringLength = 80
+
+	coderLatin1 = 0
+	coderUTF16  = 1
+)
+
+// decodeStringValue converts the backing array of java.lang.String to a Go string.
+// coder is the value of the JDK 9+ String.coder field or -1 for strings backed by char[].
+func decodeStringValue(data []byte, elemType BasicType, coder int64) string {
+	if elemType == Char {
+		// char[] elements are written to the dump in big endian order
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	if coder == coderUTF16 {
+		// byte[] of UTF16 strings keeps chars in the native order of the JVM, which is little endian on x86 and ARM
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// quoteJavaString formats a string value for output, long values are cut.
+func quoteJavaString(value string) string {
+	runes := []rune(value)
+	if len(runes) > maxDisplayedStringLength {
+		return strconv.Quote(string(runes[:maxDisplayedStringLength])) + "..."
+	}
+	return strconv.Quote(value)
+}
+
+func (g *heapGraph) isStringNode(node int32) bool {
+	return g.kinds[node] == KindInstance && g.classNames[g.classes[node]] == javaStringClass
+}
+
+// stringArrayID returns the backing array of a decoded java.lang.String.
+func stringArrayID(fields []FieldValue) ID {
+	value, ok := findField(fields, "value")
+	if !ok {
+		return 0
+	}
+	return value.asID()
+}
+
+// decodeString decodes java.lang.String fields using already loaded backing arrays.
+func (g *heapGraph) decodeString(fields []FieldValue, arrays map[ID][]byte) (string, bool) {
+	arrayID := stringArrayID(fields)
+	arrayNode, ok := g.index[arrayID]
+	if !ok || g.kinds[arrayNode] != KindPrimitiveArray {
+		return "", false
+	}
+	data, ok := arrays[arrayID]
+	if !ok {
+		return "", false
+	}
+	elemType := g.primTypes[arrayNode]
+
+	coder := int64(-1)
+	if f, ok := findField(fields, "coder"); ok {
+		coder = f.asInt()
+	}
+
+	// Old JDKs share char[] between strings using offset and count
+	if offset, ok := findField(fields, "offset"); ok && elemType == Char {
+		if count, ok := findField(fields, "count"); ok {
+			start, end := 2*offset.asInt(), 2*(offset.asInt()+count.asInt())
+			if start >= 0 && start <= end && end <= int64(len(data)) {
+				data = data[start:end]
+			}
+		}
+	}
+
+	return decodeStringValue(data, elemType, coder), true
+}
+
+// stringValue returns the decoded value of a java.lang.String node.
+func (g *heapGraph) stringValue(node int32) (string, bool) {
+	if value, ok := g.stringValues[node]; ok {
+		return value, true
+	}
+	if !g.isStringNode(node) {
+		return "", false
+	}
+
+	instance, ok := loadInstance(g.ids[node])
+	if !ok {
+		return "", false
+	}
+	fields := g.decodeFields(instance)
+	arrays, err := loadPrimitiveArrays([]ID{stringArrayID(fields)})
+	if err != nil {
+		return "", false
+	}
+	value, ok := g.decodeString(fields, arrays)
+	if ok {
+		g.stringValues[node] = value
+	}
+	return value, ok
+}
+
+// loadAllStrings decodes every java.lang.String of the dump.
+func (g *heapGraph) loadAllStrings() error {
+	if g.allStringsLoaded {
+		return nil
+	}
+
+	stringFields := make(map[int32][]FieldValue)
+	var arrayIDs []ID
+	err := forEachInstance(g.classIDsByName(javaStringClass), func(instance InstanceDump) {
+		node, ok := g.index[instance.ID]
+		if !ok {
+			return
+		}
+		fields := g.decodeFields(instance)
+		stringFields[node] = fields
+		if arrayID := stringArrayID(fields); arrayID != 0 {
+			arrayIDs = append(arrayIDs, arrayID)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("error getting strings: %w", err)
+	}
+
+	arrays, err := loadPrimitiveArrays(arrayIDs)
+	if err != nil {
+		return err
+	}
+	for node, fields := range stringFields {
+		if value, ok := g.decodeString(fields, arrays); ok {
+			g.stringValues[node] = value
+			g.stringArrays[node] = g.index[stringArrayID(fields)]
+		}
+	}
+
+	g.allStringsLoaded = true
+	return nil
+}
+
+// PrintStrings lists distinct string values containing the pattern, most frequent first.
+func PrintStrings(pattern string, max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d string values\n", max),
+		Body:   make([]string, 0),
+	}
+	if pattern != "" {
+		result.Header = fmt.Sprintf("\n\nTop %d string values containing %s\n", max, strconv.Quote(pattern))
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	if err := g.loadAllStrings(); err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error decoding strings: %v\n", err))
+		return result
+	}
+
+	type valueCount struct {
+		value string
+		count int
+		first ID
+	}
+	counts := make(map[string]*valueCount)
+	total := 0
+	for node, value := range g.stringValues {
+		if pattern != "" && !strings.Contains(value, pattern) {
+			continue
+		}
+		total++
+		if c, ok := counts[value]; ok {
+			c.count++
+			if g.ids[node] < c.first {
+				c.first = g.ids[node]
+			}
+		} else {
+			counts[value] = &valueCount{value: value, count: 1, first: g.ids[node]}
+		}
+	}
+
+	values := make([]*valueCount, 0, len(counts))
+	for _, c := range counts {
+		values = append(values, c)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].count != values[j].count {
+			return values[i].count > values[j].count
+		}
+		return values[i].value < values[j].value
+	})
+
+	result.Body = append(result.Body, fmt.Sprintf("Strings: %d, distinct values: %d\n", total, len(values)))
+	for i, v := range values {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. Count: %d, ID: %d, Value: %s\n",
+			i+1, v.count, v.first, quoteJavaString(v.value)))
+	}
+	return result
+}
+
+// PrintTopStrings lists the most frequent string values.
+func PrintTopStrings(max int) AnalyzeResult {
+	return PrintStrings("", max)
+}
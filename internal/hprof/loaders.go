@@ -0,0 +1,307 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// loaderInfo aggregates classes defined by one class loader and their instances.
+type loaderInfo struct {
+	id        ID // 0 for the bootstrap loader
+	classes   []ID
+	instances int64
+	shallow   int64 // shallow size of the instances
+	statics   int64 // static field footprint of the classes
+}
+
+// classLoaders groups loaded classes and their instances by the defining loader.
+func (g *heapGraph) classLoaders() map[ID]*loaderInfo {
+	loaders := make(map[ID]*loaderInfo)
+	loaderOf := func(id ID) *loaderInfo {
+		info, ok := loaders[id]
+		if !ok {
+			info = &loaderInfo{id: id}
+			loaders[id] = info
+		}
+		return info
+	}
+	for node, kind := range g.kinds {
+		switch kind {
+		case KindClass:
+			info := loaderOf(g.loaderOf[g.ids[node]])
+			info.classes = append(info.classes, g.ids[node])
+			info.statics += g.sizes[node]
+		case KindInstance, KindObjectArray:
+			info := loaderOf(g.loaderOf[g.classes[node]])
+			info.instances++
+			info.shallow += g.sizes[node]
+		}
+	}
+	return loaders
+}
+
+func (g *heapGraph) describeLoader(id ID) string {
+	if id == 0 {
+		return "<bootstrap>"
+	}
+	if node, ok := g.node(id); ok {
+		return g.describeNode(node)
+	}
+	return fmt.Sprintf("<unknown loader>@%d", id)
+}
+
+// staleLoaderStates are values of the lifecycle state of web application loaders after undeploy.
+var staleLoaderStates = map[string]bool{
+	"STOPPING":   true,
+	"STOPPED":    true,
+	"DESTROYING": true,
+	"DESTROYED":  true,
+	"FAILED":     true,
+}
+
+// loaderStopReason checks fields application servers use to mark a loader as shut down,
+// like WebappClassLoaderBase.state in Tomcat. It returns an empty string for active loaders.
+func (g *heapGraph) loaderStopReason(id ID) string {
+	instance, ok := loadInstance(id)
+	if !ok {
+		return ""
+	}
+	fields := g.decodeFields(instance)
+	if f, ok := findField(fields, "state"); ok && f.Type == Object {
+		if state, ok := loadInstance(f.asID()); ok {
+			if name, ok := findField(g.decodeFields(state), "name"); ok {
+				if node, ok := g.index[name.asID()]; ok {
+					if value, ok := g.stringValue(node); ok && staleLoaderStates[value] {
+						return "state " + value
+					}
+				}
+			}
+		}
+	}
+	if f, ok := findField(fields, "started"); ok && f.Type == Boolean && f.asInt() == 0 {
+		return "not started"
+	}
+	if f, ok := findField(fields, "closed"); ok && f.Type == Boolean && f.asInt() != 0 {
+		return "closed"
+	}
+	return ""
+}
+
+// duplicateClass is a class name defined by several loaders.
+type duplicateClass struct {
+	name    string
+	classes []ID
+}
+
+// loaderPair is two loaders of the same type, a < b.
+type loaderPair struct{ a, b ID }
+
+// duplicateClasses finds classes with the same name defined by different loaders, most copies first,
+// and counts class names shared by each pair of loaders of the same type.
+func (g *heapGraph) duplicateClasses(loaders map[ID]*loaderInfo) ([]duplicateClass, map[loaderPair]int) {
+	byName := make(map[string][]ID)
+	for _, info := range loaders {
+		for _, class := range info.classes {
+			name := g.className(class)
+			byName[name] = append(byName[name], class)
+		}
+	}
+	var duplicates []duplicateClass
+	sameClasses := make(map[loaderPair]int)
+	for name, classes := range byName {
+		if len(classes) < 2 {
+			continue
+		}
+		sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+		duplicates = append(duplicates, duplicateClass{name, classes})
+		for i := range classes {
+			for j := i + 1; j < len(classes); j++ {
+				a, b := g.loaderOf[classes[i]], g.loaderOf[classes[j]]
+				if a > b {
+					a, b = b, a
+				}
+				nodeA, okA := g.index[a]
+				nodeB, okB := g.index[b]
+				if okA && okB && a != b && g.classes[nodeA] == g.classes[nodeB] {
+					sameClasses[loaderPair{a, b}]++
+				}
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].classes) != len(duplicates[j].classes) {
+			return len(duplicates[i].classes) > len(duplicates[j].classes)
+		}
+		return duplicates[i].name < duplicates[j].name
+	})
+	return duplicates, sameClasses
+}
+
+// loaderSuspect is a class loader that looks like a leftover of a previous deployment.
+type loaderSuspect struct {
+	loader ID
+	reason string
+}
+
+// loaderSuspects returns loaders left over from a redeploy: loaders marked as stopped and,
+// of two loaders of the same type defining the same classes, the one with fewer live instances.
+func (g *heapGraph) loaderSuspects(loaders map[ID]*loaderInfo, sameClasses map[loaderPair]int) []loaderSuspect {
+	var suspects []loaderSuspect
+	seen := make(map[ID]bool)
+	for id := range loaders {
+		if _, ok := g.index[id]; !ok || id == 0 {
+			continue
+		}
+		if reason := g.loaderStopReason(id); reason != "" {
+			suspects = append(suspects, loaderSuspect{id, "marked as " + reason})
+			seen[id] = true
+		}
+	}
+	for pair, count := range sameClasses {
+		older, newer := pair.a, pair.b
+		if loaders[older].instances > loaders[newer].instances {
+			older, newer = newer, older
+		}
+		if !seen[older] {
+			suspects = append(suspects, loaderSuspect{older, fmt.Sprintf("redefines %d classes of %s", count, g.describeLoader(newer))})
+			seen[older] = true
+		}
+	}
+	return suspects
+}
+
+// AnalyzeClassLoaderLeaks finds classes loaded by several loaders, loaders left over from
+// previous deployments that still have live instances and paths keeping them alive.
+func AnalyzeClassLoaderLeaks(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nClass loader leak suspects (top %d)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	dom := g.dominators()
+	loaders := g.classLoaders()
+
+	instancesOf := make(map[ID]int64)
+	for node, kind := range g.kinds {
+		if kind == KindInstance || kind == KindObjectArray {
+			instancesOf[g.classes[node]]++
+		}
+	}
+
+	duplicates, sameClasses := g.duplicateClasses(loaders)
+
+	result.Body = append(result.Body, fmt.Sprintf("Class loaders: %d, classes loaded more than once: %d\n",
+		len(loaders), len(duplicates)))
+	for i, d := range duplicates {
+		if i == max {
+			break
+		}
+		copies := make([]string, 0, len(d.classes))
+		for _, class := range d.classes {
+			copies = append(copies, fmt.Sprintf("%s (%d instances)", g.describeLoader(g.loaderOf[class]), instancesOf[class]))
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: %s\n", i+1, d.name, strings.Join(copies, ", ")))
+	}
+
+	suspects := g.loaderSuspects(loaders, sameClasses)
+	sort.Slice(suspects, func(i, j int) bool {
+		a, b := g.index[suspects[i].loader], g.index[suspects[j].loader]
+		if dom.retained[a] != dom.retained[b] {
+			return dom.retained[a] > dom.retained[b]
+		}
+		return suspects[i].loader < suspects[j].loader
+	})
+
+	if len(suspects) == 0 {
+		result.Body = append(result.Body, "\nNo stale class loaders found\n")
+		return result
+	}
+	result.Body = append(result.Body, fmt.Sprintf("\nSuspected stale class loaders: %d\n", len(suspects)))
+	for i, s := range suspects {
+		if i == max {
+			break
+		}
+		info := loaders[s.loader]
+		node := g.index[s.loader]
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s, %s\n", i+1, g.describeLoader(s.loader), s.reason))
+		result.Body = append(result.Body, fmt.Sprintf("   Classes: %d, Live instances: %d, Retained: %d bytes\n",
+			len(info.classes), info.instances, dom.retained[node]))
+
+		paths := g.pathsToRoots(node, 1, true)
+		if len(paths) == 0 {
+			result.Body = append(result.Body, "   Only weakly reachable, will be collected\n")
+			continue
+		}
+		result.Body = append(result.Body, "   Kept alive by:\n")
+		result.Body = append(result.Body, g.formatPath(paths[0])...)
+	}
+	return result
+}
+
+// isClassLoader reports whether the class extends java.lang.ClassLoader.
+func (g *heapGraph) isClassLoader(classID ID) bool {
+	for current := classID; current != 0; current = g.superOf[current] {
+		if g.classNames[current] == "java.lang.ClassLoader" {
+			return true
+		}
+	}
+	return false
+}
+
+// loaderParent returns the value of ClassLoader.parent, 0 means the bootstrap loader.
+func (g *heapGraph) loaderParent(id ID) ID {
+	instance, ok := loadInstance(id)
+	if !ok {
+		return 0
+	}
+	if f, ok := findField(g.decodeFields(instance), "parent"); ok {
+		return f.asID()
+	}
+	return 0
+}
+
+// loaderTree links every class loader instance to its parent, the bootstrap loader is the root.
+func (g *heapGraph) loaderTree(loaders map[ID]*loaderInfo) map[ID][]ID {
+	isLoader := make(map[ID]bool)
+	for node, kind := range g.kinds {
+		if kind != KindInstance {
+			continue
+		}
+		class := g.classes[node]
+		is, ok := isLoader[class]
+		if !ok {
+			is = g.isClassLoader(class)
+			isLoader[class] = is
+		}
+		if is {
+			if _, ok := loaders[g.ids[node]]; !ok {
+				loaders[g.ids[node]] = &loaderInfo{id: g.ids[node]}
+			}
+		}
+	}
+	if _, ok := loaders[0]; !ok {
+		loaders[0] = &loaderInfo{}
+	}
+
+	children := make(map[ID][]ID)
+	for id := range loaders {
+		if id == 0 {
+			continue
+		}
+		parent := g.loaderParent(id)
+		if _, ok := loaders[parent]; !ok {
+			parent = 0
+		}
+		children[parent] = append(children[parent], id)
+	}
+	for _, list := range children {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	}
+	return children
+}
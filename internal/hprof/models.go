@@ -21,13 +21,17 @@ const (
 	HeapDumpEndTag     Tag = 0x2C
 )
 
+// HprofHeader is saved with the dump, analyses need the identifier size.
 type HprofHeader struct {
-	Magic          string
-	IdentifierSize int32
-	HighWord       int32
-	LowWord        int32
+	ID             ID     `gorm:"primaryKey;column:ID;autoIncrement"`
+	Magic          string `gorm:"column:Magic"`
+	IdentifierSize int32  `gorm:"column:IdentifierSize"`
+	HighWord       int32  `gorm:"column:HighWord"`
+	LowWord        int32  `gorm:"column:LowWord"`
 }
 
+func (HprofHeader) TableName() string { return "HprofHeader" }
+
 type HprofRecord struct {
 	Tag        Tag
 	Time       int32
@@ -110,14 +114,16 @@ type HeapSummary struct {
 
 // 0x0A
 type StartThread struct {
-	ThreadSerialNumber      int32
-	ThreadObjectId          ID
-	StackTraceSerialNumber  int32
-	ThreadNameStringId      ID
-	ThreadGroupNameId       ID
-	ThreadParentGroupNameId ID
+	ThreadSerialNumber      int32 `gorm:"primaryKey;column:ThreadSerialNumber"`
+	ThreadObjectId          ID    `gorm:"column:ThreadObjectID"`
+	StackTraceSerialNumber  int32 `gorm:"column:StackTraceSerialNumber"`
+	ThreadNameStringId      ID    `gorm:"column:ThreadNameStringID"`
+	ThreadGroupNameId       ID    `gorm:"column:ThreadGroupNameStringID"`
+	ThreadParentGroupNameId ID    `gorm:"column:ThreadParentGroupNameStringID"`
 }
 
+func (StartThread) TableName() string { return "StartThread" }
+
 // 0x0B
 type EndThread struct {
 	ThreadSerialNumber int32
@@ -240,6 +246,8 @@ type StackFrame struct {
 	Flag int32 `gorm:"column:Flag"`
 
 	StackTraceSerialNumber int32 `gorm:"column:StackTraceSerialNumber"`
+	// position of the frame in the stack trace, 0 is the top frame
+	IndexInStackTrace int32 `gorm:"column:IndexInStackTrace"`
 }
 
 func (StackFrame) TableName() string { return "StackFrame" }
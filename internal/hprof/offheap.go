@@ -0,0 +1,217 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Cleaner states of direct buffers
+const (
+	cleanerActive = "active"
+	cleanerFreed  = "freed"
+	cleanerNone   = "none"
+)
+
+// directBuffer is a decoded java.nio.DirectByteBuffer or MappedByteBuffer.
+type directBuffer struct {
+	node     int32
+	address  int64
+	capacity int64
+	size     int64 // native bytes allocated for the buffer, 0 for views and freed buffers
+	mapped   bool  // memory mapped file instead of allocated memory
+	view     bool  // slice or duplicate sharing memory of the buffer in att
+	cleaner  string
+}
+
+// decodeDirectBuffer reads address and capacity from java.nio.Buffer and the state of
+// the Cleaner, whose Deallocator clears its address when the memory is freed.
+func (g *heapGraph) decodeDirectBuffer(instance InstanceDump) (directBuffer, bool) {
+	node, ok := g.index[instance.ID]
+	if !ok {
+		return directBuffer{}, false
+	}
+	fields := g.decodeFields(instance)
+	buffer := directBuffer{node: node, cleaner: cleanerNone}
+	if f, ok := findField(fields, "address"); ok {
+		buffer.address = f.asInt()
+	}
+	if f, ok := findField(fields, "capacity"); ok {
+		buffer.capacity = f.asInt()
+		buffer.size = buffer.capacity
+	}
+	buffer.mapped = refField(fields, "fd") != 0
+	buffer.view = refField(fields, "att") != 0
+
+	if cleaner := refField(fields, "cleaner"); cleaner != 0 {
+		buffer.cleaner = cleanerActive
+		if cleanerFields, ok := g.instanceFields(cleaner); ok {
+			if thunk, ok := g.instanceFields(refField(cleanerFields, "thunk")); ok {
+				if address, ok := findField(thunk, "address"); ok && address.asInt() == 0 {
+					buffer.cleaner = cleanerFreed
+					buffer.size = 0
+				}
+				// Deallocator.size includes page alignment of the allocation
+				if size, ok := findField(thunk, "size"); ok && buffer.size != 0 {
+					buffer.size = size.asInt()
+				}
+			}
+		}
+	}
+	if buffer.view {
+		buffer.size = 0
+	}
+	return buffer, true
+}
+
+// bufferOwners returns owner keys of a buffer. Views are replaced by their owners and
+// the Cleaner is skipped, it refers to every buffer.
+func (g *heapGraph) bufferOwners(node int32, buffers map[int32]directBuffer, fields referrerFields, visited map[int32]bool) []string {
+	visited[node] = true
+	var keys []string
+	seen := make(map[int32]bool)
+	for _, from := range g.inbound()[node] {
+		if from == 0 || seen[from] || visited[from] {
+			continue
+		}
+		seen[from] = true
+		if referent, ok := g.referents[from]; ok && referent == node {
+			continue
+		}
+		if buffer, ok := buffers[from]; ok && buffer.view {
+			keys = append(keys, g.bufferOwners(from, buffers, fields, visited)...)
+			continue
+		}
+		keys = append(keys, g.ownerKey(from, node, fields))
+	}
+	return keys
+}
+
+// AnalyzeDirectBuffers reports native memory held by direct and mapped byte buffers, which is
+// not part of the heap sizes, by owner, and buffers kept only by their Cleaner.
+func AnalyzeDirectBuffers(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nDirect and mapped buffers (top %d owners)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+
+	buffers := make(map[int32]directBuffer)
+	err = forEachInstance(g.classIDsExtending("java.nio.MappedByteBuffer"), func(instance InstanceDump) {
+		if buffer, ok := g.decodeDirectBuffer(instance); ok {
+			buffers[buffer.node] = buffer
+		}
+	})
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading buffers: %v\n", err))
+		return result
+	}
+	if len(buffers) == 0 {
+		result.Body = append(result.Body, "No direct buffers found\n")
+		return result
+	}
+
+	nodes := make([]int32, 0, len(buffers))
+	for node := range buffers {
+		nodes = append(nodes, node)
+	}
+	fields, err := g.loadReferrers(nodes)
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading owners: %v\n", err))
+		return result
+	}
+
+	// The Cleaner is a phantom reference, buffers reachable only through it are released by the next GC
+	strong := g.reachable(g.referentEdgesOf(softReference, weakReference, phantomReference))
+	full := g.reachable(nil)
+
+	type ownerStats struct {
+		key     string
+		buffers int64
+		size    int64
+	}
+	byOwner := make(map[string]*ownerStats)
+	var direct, mapped, views, freed, directSize, mappedSize, pendingSize int64
+	var pending []directBuffer
+	for _, buffer := range buffers {
+		switch {
+		case buffer.view:
+			views++
+			continue
+		case buffer.cleaner == cleanerFreed:
+			freed++
+			continue
+		case buffer.mapped:
+			mapped++
+			mappedSize += buffer.size
+		default:
+			direct++
+			directSize += buffer.size
+		}
+		if full[buffer.node] && !strong[buffer.node] {
+			pending = append(pending, buffer)
+			pendingSize += buffer.size
+		}
+
+		keys := g.bufferOwners(buffer.node, buffers, fields, make(map[int32]bool))
+		if len(keys) == 0 {
+			keys = []string{"<unreferenced>"}
+		}
+		for key := range countKeys(keys) {
+			stats, ok := byOwner[key]
+			if !ok {
+				stats = &ownerStats{key: key}
+				byOwner[key] = stats
+			}
+			stats.buffers++
+			stats.size += buffer.size
+		}
+	}
+
+	result.Body = append(result.Body, fmt.Sprintf("Direct buffers: %d, Off-heap: %d bytes\n", direct, directSize))
+	result.Body = append(result.Body, fmt.Sprintf("Mapped buffers: %d, Mapped: %d bytes\n", mapped, mappedSize))
+	result.Body = append(result.Body, fmt.Sprintf("Views sharing memory of other buffers: %d, Already freed: %d\n", views, freed))
+
+	owners := make([]*ownerStats, 0, len(byOwner))
+	for _, stats := range byOwner {
+		owners = append(owners, stats)
+	}
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].size != owners[j].size {
+			return owners[i].size > owners[j].size
+		}
+		return owners[i].key < owners[j].key
+	})
+	result.Body = append(result.Body, "\nOff-heap memory by owner:\n")
+	for i, owner := range owners {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Buffers: %d, Off-heap: %d bytes\n",
+			i+1, owner.key, owner.buffers, owner.size))
+	}
+
+	if len(pending) == 0 {
+		return result
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].size != pending[j].size {
+			return pending[i].size > pending[j].size
+		}
+		return pending[i].node < pending[j].node
+	})
+	result.Body = append(result.Body, fmt.Sprintf("\nReachable only through Cleaner: %d buffers, %d bytes freed by the next GC\n",
+		len(pending), pendingSize))
+	for i, buffer := range pending {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s, Address: %#x, Capacity: %d\n",
+			i+1, g.describeNode(buffer.node), buffer.address, buffer.capacity))
+	}
+	return result
+}
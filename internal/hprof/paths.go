@@ -0,0 +1,310 @@
+package hprof
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// maxPathExpansions bounds the search for K shortest paths on huge graphs.
+const maxPathExpansions = 1000000
+
+type pathStep struct {
+	node   int32
+	next   *pathStep // towards the target object
+	length int
+}
+
+func (p *pathStep) contains(node int32) bool {
+	for step := p; step != nil; step = step.next {
+		if step.node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsToRoots finds up to k shortest reference chains from GC roots to the target.
+// Every path starts at a GC root and ends at the target node.
+func (g *heapGraph) pathsToRoots(target int32, k int, excludeWeak bool) [][]int32 {
+	in := g.inbound()
+	var paths [][]int32
+
+	// Breadth-first search over partial paths going backwards from the target,
+	// every node is expanded at most k times, so the first k complete paths are the shortest ones.
+	expanded := make(map[int32]int)
+	queue := []*pathStep{{node: target, length: 1}}
+	for expansions := 0; len(queue) > 0 && len(paths) < k && expansions < maxPathExpansions; expansions++ {
+		current := queue[0]
+		queue = queue[1:]
+
+		if len(g.rootsOfNode(current.node)) > 0 {
+			path := make([]int32, 0, current.length)
+			for step := current; step != nil; step = step.next {
+				path = append(path, step.node)
+			}
+			paths = append(paths, path)
+			continue
+		}
+
+		if expanded[current.node] >= k {
+			continue
+		}
+		expanded[current.node]++
+
+		for _, referrer := range in[current.node] {
+			if referrer == 0 || current.contains(referrer) {
+				continue
+			}
+			if excludeWeak && g.isWeakEdge(referrer, current.node) {
+				continue
+			}
+			queue = append(queue, &pathStep{node: referrer, next: current, length: current.length + 1})
+		}
+	}
+
+	return paths
+}
+
+// namedReference is a reference held by a field, a static field or a header slot of an object.
+type namedReference struct {
+	name   string
+	target ID
+}
+
+// referrerFields are references of referring objects preloaded by loadReferrers.
+type referrerFields map[int32][]namedReference
+
+// instanceReferences lists the class pointer and the object fields of an instance.
+func (g *heapGraph) instanceReferences(instance InstanceDump) []namedReference {
+	refs := []namedReference{{"<class>", instance.ClassObjectID}}
+	offset := 0
+	for _, field := range g.fieldLayout(instance.ClassObjectID) {
+		if field.Type == Object && offset+8 <= len(instance.Data) {
+			refs = append(refs, namedReference{g.fieldName(field.FieldNameStringID), ID(binary.BigEndian.Uint64(instance.Data[offset : offset+8]))})
+		}
+		offset += int(field.Type.GetSize())
+	}
+	return refs
+}
+
+// classReferences lists the header slots and the static object fields of a class.
+func (g *heapGraph) classReferences(class ClassDump, staticFields []StaticFieldRecord) []namedReference {
+	refs := []namedReference{
+		{"<super>", class.SuperClassObjectID},
+		{"<classloader>", class.ClassLoaderObjectID},
+		{"<signers>", class.SignersObjectID},
+		{"<protection domain>", class.ProtectionDomainObjectID},
+	}
+	for _, sf := range staticFields {
+		if sf.Type == Object && len(sf.Value) >= 8 {
+			refs = append(refs, namedReference{"static " + g.fieldName(sf.StaticFieldNameStringID), ID(binary.BigEndian.Uint64(sf.Value))})
+		}
+	}
+	return refs
+}
+
+// referenceNames joins names of the references to the target, "?" when there are none.
+func referenceNames(refs []namedReference, target ID) string {
+	var names []string
+	for _, ref := range refs {
+		if ref.target == target && target != 0 {
+			names = append(names, ref.name)
+		}
+	}
+	if len(names) == 0 {
+		return "?"
+	}
+	return strings.Join(names, ", ")
+}
+
+// describeReference explains how the object "from" refers to the object "to":
+// field name, static field name or array index.
+func (g *heapGraph) describeReference(from, to int32) string {
+	target := g.ids[to]
+
+	switch g.kinds[from] {
+	case KindInstance:
+		instance, ok := loadInstance(g.ids[from])
+		if !ok {
+			return "?"
+		}
+		return referenceNames(g.instanceReferences(instance), target)
+
+	case KindObjectArray:
+		var names []string
+		if g.classes[from] == target {
+			names = append(names, "<class>")
+		}
+		var elements []ObjectArrayElement
+		if err := GetDB().Where("\"ObjectArrayDumpID\" = ? AND \"InstanceDumpID\" = ?", g.ids[from], target).
+			Order("\"Index\"").Find(&elements).Error; err == nil {
+			for _, element := range elements {
+				names = append(names, fmt.Sprintf("[%d]", element.Index))
+			}
+		}
+		if len(names) == 0 {
+			return "?"
+		}
+		return strings.Join(names, ", ")
+
+	case KindClass:
+		var class ClassDump
+		if err := GetDB().Where("\"ID\" = ?", g.ids[from]).First(&class).Error; err != nil {
+			return "?"
+		}
+		var staticFields []StaticFieldRecord
+		if err := GetDB().Where("\"ClassDumpID\" = ? AND \"Type\" = ?", g.ids[from], Object).Find(&staticFields).Error; err != nil {
+			return "?"
+		}
+		return referenceNames(g.classReferences(class, staticFields), target)
+	}
+	return "?"
+}
+
+// loadReferrers loads fields of all instances and classes referring to the nodes, a query covers
+// up to 1000 referrers. Owner keys of many objects are built from one batch instead of a query per referrer.
+func (g *heapGraph) loadReferrers(nodes []int32) (referrerFields, error) {
+	var instanceIDs, classIDs []ID
+	seen := make(map[int32]bool)
+	for _, node := range nodes {
+		for _, from := range g.inbound()[node] {
+			if seen[from] {
+				continue
+			}
+			seen[from] = true
+			switch g.kinds[from] {
+			case KindInstance:
+				instanceIDs = append(instanceIDs, g.ids[from])
+			case KindClass:
+				classIDs = append(classIDs, g.ids[from])
+			}
+		}
+	}
+
+	fields := make(referrerFields, len(seen))
+	const chunkSize = 1000
+	for start := 0; start < len(instanceIDs); start += chunkSize {
+		end := start + chunkSize
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		var instances []InstanceDump
+		if err := GetDB().Where("\"ID\" IN ?", instanceIDs[start:end]).Find(&instances).Error; err != nil {
+			return nil, fmt.Errorf("error getting referring instances: %w", err)
+		}
+		for _, instance := range instances {
+			fields[g.index[instance.ID]] = g.instanceReferences(instance)
+		}
+	}
+	for start := 0; start < len(classIDs); start += chunkSize {
+		end := start + chunkSize
+		if end > len(classIDs) {
+			end = len(classIDs)
+		}
+		var classes []ClassDump
+		if err := GetDB().Where("\"ID\" IN ?", classIDs[start:end]).Find(&classes).Error; err != nil {
+			return nil, fmt.Errorf("error getting referring classes: %w", err)
+		}
+		var staticFields []StaticFieldRecord
+		if err := GetDB().Where("\"ClassDumpID\" IN ? AND \"Type\" = ?", classIDs[start:end], Object).
+			Find(&staticFields).Error; err != nil {
+			return nil, fmt.Errorf("error getting static fields of referring classes: %w", err)
+		}
+		staticsOf := make(map[ID][]StaticFieldRecord)
+		for _, sf := range staticFields {
+			staticsOf[sf.ClassDumpID] = append(staticsOf[sf.ClassDumpID], sf)
+		}
+		for _, class := range classes {
+			fields[g.index[class.ID]] = g.classReferences(class, staticsOf[class.ID])
+		}
+	}
+	return fields, nil
+}
+
+// ownerKey names the field holding the reference without the concrete object,
+// so references from many instances of one class can be aggregated.
+// Fields of the referrer come from loadReferrers, arrays and GC roots need none.
+func (g *heapGraph) ownerKey(from, to int32, fields referrerFields) string {
+	switch g.kinds[from] {
+	case KindSuperRoot:
+		return "<GC root>"
+	case KindObjectArray:
+		return g.nodeClassName(from) + "[*]"
+	case KindClass:
+		return g.className(g.ids[from]) + "." + referenceNames(fields[from], g.ids[to])
+	}
+	return g.nodeClassName(from) + "." + referenceNames(fields[from], g.ids[to])
+}
+
+// ownerKeys returns owner keys of all objects referring to the node.
+func (g *heapGraph) ownerKeys(node int32, fields referrerFields) []string {
+	var keys []string
+	seen := make(map[int32]bool)
+	for _, from := range g.inbound()[node] {
+		if from != 0 && !seen[from] {
+			seen[from] = true
+			keys = append(keys, g.ownerKey(from, node, fields))
+		}
+	}
+	return keys
+}
+
+func describeRoot(root GCRoot) string {
+	switch root.Type {
+	case RootJavaFrameTag, RootJNILocalTag:
+		return fmt.Sprintf("%s (thread %d, frame %d)", root.Type, root.ThreadSerialNumber, root.FrameNumber)
+	case RootNativeStackTag, RootThreadBlockTag, RootThreadObjectTag:
+		return fmt.Sprintf("%s (thread %d)", root.Type, root.ThreadSerialNumber)
+	}
+	return root.Type.String()
+}
+
+func (g *heapGraph) formatPath(path []int32) []string {
+	lines := make([]string, 0, len(path))
+	roots := make([]string, 0)
+	for _, root := range g.rootsOfNode(path[0]) {
+		roots = append(roots, describeRoot(root))
+	}
+	lines = append(lines, fmt.Sprintf("   %s [GC root: %s]\n", g.describeNode(path[0]), strings.Join(roots, ", ")))
+	for i := 1; i < len(path); i++ {
+		lines = append(lines, fmt.Sprintf("   %s-> %s: %s\n",
+			strings.Repeat("  ", i-1), g.describeReference(path[i-1], path[i]), g.describeNode(path[i])))
+	}
+	return lines
+}
+
+// PrintPathsToRoots prints up to k shortest reference chains from GC roots to the object.
+func PrintPathsToRoots(objectID ID, k int, excludeWeak bool) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nShortest paths from GC roots to object %d\n", objectID),
+		Body:   make([]string, 0),
+	}
+	if k < 1 {
+		k = 1
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+
+	target, ok := g.node(objectID)
+	if !ok {
+		result.Body = append(result.Body, fmt.Sprintf("Object %d not found\n", objectID))
+		return result
+	}
+
+	paths := g.pathsToRoots(target, k, excludeWeak)
+	if len(paths) == 0 {
+		result.Body = append(result.Body, fmt.Sprintf("Object %s is not reachable from GC roots\n", g.describeNode(target)))
+		return result
+	}
+
+	for i, path := range paths {
+		result.Body = append(result.Body, fmt.Sprintf("%d. Path of %d objects:\n", i+1, len(path)))
+		result.Body = append(result.Body, g.formatPath(path)...)
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+func (k referenceKind) String() string {
+	switch k {
+	case strongReference:
+		return "strong"
+	case softReference:
+		return "soft"
+	case weakReference:
+		return "weak"
+	case phantomReference:
+		return "phantom"
+	case finalReference:
+		return "final"
+	}
+	return "none"
+}
+
+// referentEdgesOf returns a filter matching referent edges of references of the given kinds.
+func (g *heapGraph) referentEdgesOf(kinds ...referenceKind) func(from, to int32) bool {
+	return func(from, to int32) bool {
+		if g.kinds[from] != KindInstance {
+			return false
+		}
+		referent, ok := g.referents[from]
+		if !ok || referent != to {
+			return false
+		}
+		kind := g.referenceKindOf(g.classes[from])
+		for _, k := range kinds {
+			if kind == k {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// referenceGroup sums soft, weak or phantom references of one kind by referent class.
+type referenceGroup struct {
+	kind       referenceKind
+	class      string
+	references int64
+	shallow    int64
+	onlyHere   int64 // referents not reachable without references of this kind
+}
+
+// referenceGroups groups soft, weak and phantom references, largest referents first, and computes
+// memory freed when soft references are cleared and after all of them are processed.
+func (g *heapGraph) referenceGroups() (list []*referenceGroup, freedSoft, freedWeak int64) {
+	full := g.reachable(nil)
+	withoutSoft := g.reachable(g.referentEdgesOf(softReference))
+	withoutWeak := g.reachable(g.referentEdgesOf(softReference, weakReference, phantomReference))
+
+	type groupKey struct {
+		kind  referenceKind
+		class string
+	}
+	groups := make(map[groupKey]*referenceGroup)
+	for ref, referent := range g.referents {
+		kind := g.referenceKindOf(g.classes[ref])
+		if !kind.isWeak() {
+			continue
+		}
+		key := groupKey{kind, g.nodeClassName(referent)}
+		stats, ok := groups[key]
+		if !ok {
+			stats = &referenceGroup{kind: key.kind, class: key.class}
+			groups[key] = stats
+		}
+		stats.references++
+		stats.shallow += g.sizes[referent]
+		weaklyHeld := !withoutWeak[referent]
+		if kind == softReference {
+			weaklyHeld = !withoutSoft[referent]
+		}
+		if full[referent] && weaklyHeld {
+			stats.onlyHere++
+		}
+	}
+
+	for node := range g.ids {
+		if !full[node] {
+			continue
+		}
+		if !withoutSoft[node] {
+			freedSoft += g.sizes[node]
+		}
+		if !withoutWeak[node] {
+			freedWeak += g.sizes[node]
+		}
+	}
+
+	list = make([]*referenceGroup, 0, len(groups))
+	for _, stats := range groups {
+		list = append(list, stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].shallow != list[j].shallow {
+			return list[i].shallow > list[j].shallow
+		}
+		if list[i].kind != list[j].kind {
+			return list[i].kind < list[j].kind
+		}
+		return list[i].class < list[j].class
+	})
+	return list, freedSoft, freedWeak
+}
+
+// AnalyzeReferences groups java.lang.ref.Reference instances by kind and referent class
+// and computes memory freed when soft references are cleared and after weak ones are processed.
+func AnalyzeReferences(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nWeak, soft and phantom references (top %d referent classes)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	if graphOptions.IgnoreWeakReferences {
+		result.Body = append(result.Body, "Referent edges are ignored by graph options, only referents reachable otherwise are counted\n")
+	}
+
+	list, freedSoft, freedWeak := g.referenceGroups()
+	result.Body = append(result.Body, fmt.Sprintf("Freed if soft references are cleared: %d bytes\n", freedSoft))
+	result.Body = append(result.Body, fmt.Sprintf("Freed if all soft, weak and phantom references are cleared: %d bytes\n", freedWeak))
+
+	if len(list) == 0 {
+		result.Body = append(result.Body, "No weak, soft or phantom references found\n")
+		return result
+	}
+	result.Body = append(result.Body, "\nBy reference kind and referent class:\n")
+	for i, stats := range list {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s -> %s: References: %d, Referents shallow: %d, Only reachable this way: %d\n",
+			i+1, stats.kind, stats.class, stats.references, stats.shallow, stats.onlyHere))
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PrintReferrers lists objects, static fields, array slots and GC roots referring to the object,
+// together with counts of referrers per class.
+func PrintReferrers(objectID ID, max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nReferrers of object %d\n", objectID),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	node, ok := g.node(objectID)
+	if !ok {
+		result.Body = append(result.Body, fmt.Sprintf("Object %d not found\n", objectID))
+		return result
+	}
+	result.Body = append(result.Body, fmt.Sprintf("Object: %s\n", g.describeNode(node)))
+
+	for _, root := range g.rootsOfNode(node) {
+		result.Body = append(result.Body, fmt.Sprintf("GC root: %s\n", describeRoot(root)))
+	}
+
+	referrers := make([]int32, 0)
+	byClass := make(map[string]int64)
+	seen := make(map[int32]bool)
+	for _, from := range g.inbound()[node] {
+		// An object referring to the target from several fields has one edge per field
+		if from == 0 || seen[from] {
+			continue
+		}
+		seen[from] = true
+		referrers = append(referrers, from)
+		byClass[g.nodeClassName(from)]++
+	}
+	if len(referrers) == 0 {
+		result.Body = append(result.Body, "No objects refer to this object\n")
+		return result
+	}
+	sort.Slice(referrers, func(i, j int) bool { return g.ids[referrers[i]] < g.ids[referrers[j]] })
+
+	result.Body = append(result.Body, fmt.Sprintf("\nReferrers by class (%d objects):\n", len(referrers)))
+	for i, c := range topCounts(byClass, -1) {
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: %d\n", i+1, c.key, c.count))
+	}
+
+	result.Body = append(result.Body, "\nReferences:\n")
+	for i, from := range referrers {
+		if i == max {
+			result.Body = append(result.Body, fmt.Sprintf("... %d more\n", len(referrers)-max))
+			break
+		}
+		via := g.describeReference(from, node)
+		if g.isWeakEdge(from, node) {
+			via += " (weak)"
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s -> %s\n", i+1, g.describeNode(from), via))
+	}
+	return result
+}
@@ -0,0 +1,225 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SizeModel describes how the JVM lays out objects in memory. Sizes in the dump
+// always use the identifier size for references, so real shallow sizes are computed with the model.
+type SizeModel struct {
+	Name             string
+	ReferenceSize    int64 // reference fields and object array slots
+	ObjectHeaderSize int64 // mark word and class pointer
+	ArrayHeaderSize  int64 // object header and array length
+	Alignment        int64
+	// Guess explains why the model was picked by AutoSizeModel, empty for models selected by name
+	Guess string
+}
+
+// AutoSizeModel selects the model from the dump content.
+const AutoSizeModel = "auto"
+
+// SizeModels are layouts of the HotSpot JVM. 64bit-ccp compresses class pointers but not
+// references, the JVM does so for -Xmx of 32 GB and more since JDK 15.
+var SizeModels = map[string]SizeModel{
+	"32bit":       {Name: "32bit", ReferenceSize: 4, ObjectHeaderSize: 8, ArrayHeaderSize: 12, Alignment: 8},
+	"64bit":       {Name: "64bit", ReferenceSize: 8, ObjectHeaderSize: 16, ArrayHeaderSize: 24, Alignment: 8},
+	"64bit-ccp":   {Name: "64bit-ccp", ReferenceSize: 8, ObjectHeaderSize: 12, ArrayHeaderSize: 16, Alignment: 8},
+	"64bit-coops": {Name: "64bit-coops", ReferenceSize: 4, ObjectHeaderSize: 12, ArrayHeaderSize: 16, Alignment: 8},
+	"lilliput":    {Name: "lilliput", ReferenceSize: 4, ObjectHeaderSize: 8, ArrayHeaderSize: 12, Alignment: 8},
+}
+
+// compressedOopsHeapLimit is the largest -Xmx the JVM uses compressed references for by default.
+const compressedOopsHeapLimit = int64(32) << 30
+
+var (
+	sizeModelName     = AutoSizeModel
+	detectedSizeModel *SizeModel
+)
+
+// SizeModelNames lists accepted names of SetSizeModel.
+func SizeModelNames() []string {
+	names := []string{AutoSizeModel}
+	for name := range SizeModels {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// SetSizeModel selects one of SizeModels or AutoSizeModel, the cached graph is rebuilt on change.
+func SetSizeModel(name string) error {
+	if _, ok := SizeModels[name]; !ok && name != AutoSizeModel {
+		return fmt.Errorf("unknown size model %q, expected one of %s", name, strings.Join(SizeModelNames(), ", "))
+	}
+	if name != sizeModelName {
+		sizeModelName = name
+		resetHeapGraph()
+	}
+	return nil
+}
+
+// currentSizeModel returns the selected model, the automatic choice is detected once per dump.
+func currentSizeModel() SizeModel {
+	if model, ok := SizeModels[sizeModelName]; ok {
+		return model
+	}
+	if detectedSizeModel == nil {
+		model := detectSizeModel()
+		detectedSizeModel = &model
+	}
+	return *detectedSizeModel
+}
+
+// label is the model name marked when it was guessed.
+func (m SizeModel) label() string {
+	if m.Guess != "" {
+		return m.Name + " (guessed)"
+	}
+	return m.Name
+}
+
+func alignUp(size, alignment int64) int64 {
+	if alignment <= 1 {
+		return size
+	}
+	return (size + alignment - 1) / alignment * alignment
+}
+
+func (m SizeModel) align(size int64) int64 {
+	return alignUp(size, m.Alignment)
+}
+
+func (m SizeModel) fieldSize(t BasicType) int64 {
+	if t == Object {
+		return m.ReferenceSize
+	}
+	return int64(t.GetSize())
+}
+
+// instanceSize lays out fields of the class and all superclasses like HotSpot does. Fields are listed
+// by fieldLayout, own fields of the class first, and are placed starting from the topmost superclass.
+// Fields of a subclass start at the end of its superclass rounded up to the reference size.
+func (m SizeModel) instanceSize(fields []InstanceFieldRecord) int64 {
+	var classes [][]int64
+	for i, field := range fields {
+		if i == 0 || field.ClassDumpID != fields[i-1].ClassDumpID {
+			classes = append(classes, nil)
+		}
+		classes[len(classes)-1] = append(classes[len(classes)-1], m.fieldSize(field.Type))
+	}
+	offset := m.ObjectHeaderSize
+	for i := len(classes) - 1; i >= 0; i-- {
+		if i != len(classes)-1 {
+			offset = alignUp(offset, m.ReferenceSize)
+		}
+		offset = layoutFields(offset, classes[i])
+	}
+	return m.align(offset)
+}
+
+// layoutFields places fields of one class largest first, every field aligned to its size, and returns
+// the end offset. Smaller fields fill the gap an 8 byte field would leave after the previous fields.
+func layoutFields(offset int64, sizes []int64) int64 {
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] > sizes[j] })
+	if len(sizes) > 0 && sizes[0] == 8 && offset%8 != 0 {
+		gapEnd := alignUp(offset, 8)
+		var rest []int64
+		for _, size := range sizes {
+			if size < 8 && alignUp(offset, size)+size <= gapEnd {
+				offset = alignUp(offset, size) + size
+			} else {
+				rest = append(rest, size)
+			}
+		}
+		sizes = rest
+	}
+	for _, size := range sizes {
+		offset = alignUp(offset, size) + size
+	}
+	return offset
+}
+
+func (m SizeModel) arraySize(elemType BasicType, length int32) int64 {
+	return m.align(m.ArrayHeaderSize + int64(length)*m.fieldSize(elemType))
+}
+
+// staticsSize is the footprint of static fields of a class.
+func (m SizeModel) staticsSize(fields []StaticFieldRecord) int64 {
+	var size int64
+	for _, field := range fields {
+		size += m.fieldSize(field.Type)
+	}
+	return size
+}
+
+// objectArraySizeSQL returns an SQL expression computing the size of object arrays from the length column.
+func (m SizeModel) objectArraySizeSQL(lengthColumn string) string {
+	return fmt.Sprintf("((%d + %s * %d + %d) / %d * %d)",
+		m.ArrayHeaderSize, lengthColumn, m.ReferenceSize, m.Alignment-1, m.Alignment, m.Alignment)
+}
+
+// primitiveArraySizeSQL returns an SQL expression computing the size of primitive arrays
+// from the length and element type columns.
+func (m SizeModel) primitiveArraySizeSQL(lengthColumn, typeColumn string) string {
+	elemSize := fmt.Sprintf("CASE %s WHEN %d THEN 1 WHEN %d THEN 1 WHEN %d THEN 2 WHEN %d THEN 2 WHEN %d THEN 4 WHEN %d THEN 4 WHEN %d THEN 8 WHEN %d THEN 8 ELSE 0 END",
+		typeColumn, Boolean, Byte, Char, Short, Float, Int, Double, Long)
+	return fmt.Sprintf("((%d + %s * %s + %d) / %d * %d)",
+		m.ArrayHeaderSize, lengthColumn, elemSize, m.Alignment-1, m.Alignment, m.Alignment)
+}
+
+// detectIDSize reads the identifier size from the header of the parsed dump.
+func detectIDSize() (int64, error) {
+	var header HprofHeader
+	if err := GetDB().Order("\"ID\" DESC").Limit(1).Find(&header).Error; err != nil {
+		return 0, fmt.Errorf("error getting dump header: %w", err)
+	}
+	if header.IdentifierSize == 0 {
+		return 0, fmt.Errorf("dump header is not in the database")
+	}
+	return int64(header.IdentifierSize), nil
+}
+
+// liveHeapLowerBound sums sizes of all objects with compressed references. References take
+// 8 bytes in the instance data of the dump, so half of the data is the smallest possible size.
+func liveHeapLowerBound() (int64, error) {
+	coops := SizeModels["64bit-coops"]
+	var heap struct {
+		Size int64 `gorm:"column:heap_size"`
+	}
+	query := fmt.Sprintf(`
+		SELECT
+			(SELECT COALESCE(SUM(%d + "NumberOfBytes" / 2), 0) FROM "InstanceDump") +
+			(SELECT COALESCE(SUM(%s), 0) FROM "ObjectArrayDump") +
+			(SELECT COALESCE(SUM(%s), 0) FROM "PrimitiveArrayDump") as heap_size
+	`, coops.ObjectHeaderSize, coops.objectArraySizeSQL("\"NumberOfElements\""),
+		coops.primitiveArraySizeSQL("\"NumberOfElements\"", "\"Type\""))
+	if err := GetDB().Raw(query).Scan(&heap).Error; err != nil {
+		return 0, fmt.Errorf("error getting heap size: %w", err)
+	}
+	return heap.Size, nil
+}
+
+// detectSizeModel guesses the layout the JVM used: 32-bit VMs write 4 byte identifiers, 64-bit VMs
+// compress references unless -Xmx is 32 GB or more. The dump does not keep -Xmx, so uncompressed
+// references are only chosen when the live objects do not fit into 32 GB even with compressed ones.
+func detectSizeModel() SizeModel {
+	model := SizeModels["64bit-coops"]
+	if idSize, err := detectIDSize(); err != nil {
+		model.Guess = fmt.Sprintf("%v, 64-bit JVM assumed", err)
+	} else if idSize == 4 {
+		model = SizeModels["32bit"]
+		model.Guess = "4 byte identifiers in the dump header"
+	} else if live, err := liveHeapLowerBound(); err != nil {
+		model.Guess = fmt.Sprintf("%v, heap below 32 GB assumed", err)
+	} else if live >= compressedOopsHeapLimit {
+		model = SizeModels["64bit-ccp"]
+		model.Guess = fmt.Sprintf("live objects need at least %d bytes even with compressed references", live)
+	} else {
+		model.Guess = "default of heaps below 32 GB, -Xmx is not in the dump"
+	}
+	fmt.Printf("Size model %s is guessed: %s. Use --size-model to set it\n", model.Name, model.Guess)
+	return model
+}
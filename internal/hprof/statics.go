@@ -0,0 +1,137 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// staticFieldInfo is a static reference field and the object it holds.
+type staticFieldInfo struct {
+	class  ID
+	name   string
+	target int32
+	shared bool // the target is also reachable without the class
+}
+
+// staticReferences lists static fields referencing objects of the graph.
+func (g *heapGraph) staticReferences() ([]staticFieldInfo, error) {
+	var staticFields []StaticFieldRecord
+	if err := GetDB().Where("\"Type\" = ?", Object).Order("\"ID\"").Find(&staticFields).Error; err != nil {
+		return nil, fmt.Errorf("error getting static fields: %w", err)
+	}
+	dom := g.dominators()
+	fields := make([]staticFieldInfo, 0, len(staticFields))
+	for _, sf := range staticFields {
+		classNode, ok := g.index[sf.ClassDumpID]
+		if !ok {
+			continue
+		}
+		target, ok := g.index[FieldValue{Type: sf.Type, Value: sf.Value}.asID()]
+		if !ok || g.kinds[target] == KindClass || !dom.isReachable(target) {
+			continue
+		}
+		fields = append(fields, staticFieldInfo{
+			class:  sf.ClassDumpID,
+			name:   g.fieldName(sf.StaticFieldNameStringID),
+			target: target,
+			shared: dom.idom[target] != classNode,
+		})
+	}
+	return fields, nil
+}
+
+// retainedClasses sums shallow sizes of all objects in the dominator subtree of the node by class.
+func (g *heapGraph) retainedClasses(node int32, max int) []string {
+	dom := g.dominators()
+
+	type classShare struct {
+		name  string
+		count int
+		size  int64
+	}
+	byClass := make(map[string]*classShare)
+	stack := []int32{node}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		name := g.nodeClassName(current)
+		share, ok := byClass[name]
+		if !ok {
+			share = &classShare{name: name}
+			byClass[name] = share
+		}
+		share.count++
+		share.size += g.sizes[current]
+		stack = append(stack, dom.dominated(current)...)
+	}
+
+	shares := make([]*classShare, 0, len(byClass))
+	for _, share := range byClass {
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].size != shares[j].size {
+			return shares[i].size > shares[j].size
+		}
+		return shares[i].name < shares[j].name
+	})
+
+	lines := make([]string, 0, max)
+	for i, share := range shares {
+		if i == max {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("     %d objects of %s, %d bytes\n", share.count, share.name, share.size))
+	}
+	return lines
+}
+
+// AnalyzeStaticFields ranks static reference fields by the retained size of the objects they hold,
+// static caches and registries are the most common source of leaks.
+func AnalyzeStaticFields(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d static fields by retained size\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	fields, err := g.staticReferences()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading static fields: %v\n", err))
+		return result
+	}
+	if len(fields) == 0 {
+		result.Body = append(result.Body, "No static reference fields found\n")
+		return result
+	}
+	dom := g.dominators()
+
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := dom.retained[fields[i].target], dom.retained[fields[j].target]
+		if a != b {
+			return a > b
+		}
+		if fields[i].class != fields[j].class {
+			return fields[i].class < fields[j].class
+		}
+		return fields[i].name < fields[j].name
+	})
+
+	for i, f := range fields {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s.%s = %s, Retained: %d bytes\n",
+			i+1, g.className(f.class), f.name, g.describeNode(f.target), dom.retained[f.target]))
+		if f.shared {
+			// Such objects stay alive when the field is cleared, their size is not freed
+			result.Body = append(result.Body, fmt.Sprintf("   Shared with other paths, dominated by %s\n", g.describeNode(dom.idom[f.target])))
+		}
+		result.Body = append(result.Body, g.retainedClasses(f.target, 3)...)
+	}
+	return result
+}
@@ -0,0 +1,176 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// accumulationShare is the share of retained size a single dominated object must keep
+// to continue the descent towards the accumulation point.
+const accumulationShare = 0.8
+
+// accumulationPoint descends the dominator tree while one child keeps most of the retained size.
+// It returns the chain from the start node to the accumulation point.
+func (g *heapGraph) accumulationPoint(start int32) []int32 {
+	dom := g.dominators()
+	chain := []int32{start}
+	current := start
+	for {
+		children := dom.dominated(current)
+		if len(children) == 0 {
+			break
+		}
+		biggest := children[0]
+		if float64(dom.retained[biggest]) < accumulationShare*float64(dom.retained[current]) {
+			break
+		}
+		chain = append(chain, biggest)
+		current = biggest
+	}
+	return chain
+}
+
+// describeDominatedClasses summarizes objects directly dominated by the node grouped by class.
+func (g *heapGraph) describeDominatedClasses(node int32, max int) []string {
+	dom := g.dominators()
+
+	type classShare struct {
+		name     string
+		count    int
+		retained int64
+	}
+	byClass := make(map[string]*classShare)
+	for _, child := range dom.dominated(node) {
+		name := g.nodeClassName(child)
+		share, ok := byClass[name]
+		if !ok {
+			share = &classShare{name: name}
+			byClass[name] = share
+		}
+		share.count++
+		share.retained += dom.retained[child]
+	}
+
+	shares := make([]*classShare, 0, len(byClass))
+	for _, share := range byClass {
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].retained > shares[j].retained
+	})
+
+	lines := make([]string, 0, max)
+	for i, share := range shares {
+		if i == max {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("     %d objects of %s, retained %d bytes\n", share.count, share.name, share.retained))
+	}
+	return lines
+}
+
+func (g *heapGraph) explainSuspect(node int32) []string {
+	dom := g.dominators()
+	lines := make([]string, 0)
+
+	chain := g.accumulationPoint(node)
+	point := chain[len(chain)-1]
+	lines = append(lines, fmt.Sprintf("   Accumulation point: %s, retained %d bytes\n", g.describeNode(point), dom.retained[point]))
+	for i := 1; i < len(chain); i++ {
+		via := "<indirect>"
+		if g.refersTo(chain[i-1], chain[i]) {
+			via = g.describeReference(chain[i-1], chain[i])
+		}
+		lines = append(lines, fmt.Sprintf("     -> %s: %s\n", via, g.describeNode(chain[i])))
+	}
+	lines = append(lines, "   Accumulated objects:\n")
+	lines = append(lines, g.describeDominatedClasses(point, 3)...)
+
+	paths := g.pathsToRoots(node, 1, false)
+	if len(paths) > 0 {
+		lines = append(lines, "   Shortest path from GC roots:\n")
+		lines = append(lines, g.formatPath(paths[0])...)
+	}
+	return lines
+}
+
+// AnalyzeLeakSuspects reports objects and groups of same-class objects
+// that retain at least thresholdPercent of the reachable heap.
+func AnalyzeLeakSuspects(thresholdPercent int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nLeak suspects (retaining >= %d%% of heap)\n", thresholdPercent),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	dom := g.dominators()
+
+	total := dom.retained[0]
+	if total == 0 {
+		result.Body = append(result.Body, "Heap is empty\n")
+		return result
+	}
+	threshold := total * int64(thresholdPercent) / 100
+	result.Body = append(result.Body, fmt.Sprintf("Total reachable heap: %d bytes\n\n", total))
+
+	suspects := 0
+
+	// Single objects among the top level dominators
+	topLevel := dom.dominated(0)
+	groups := make(map[ID][]int32)
+	for _, node := range topLevel {
+		if dom.retained[node] >= threshold {
+			suspects++
+			result.Body = append(result.Body, fmt.Sprintf("%d. %s retains %d bytes (%.1f%%)\n",
+				suspects, g.describeNode(node), dom.retained[node], percentOf(dom.retained[node], total)))
+			result.Body = append(result.Body, g.explainSuspect(node)...)
+			result.Body = append(result.Body, "\n")
+			continue
+		}
+		if g.kinds[node] == KindInstance || g.kinds[node] == KindObjectArray {
+			groups[g.classes[node]] = append(groups[g.classes[node]], node)
+		}
+	}
+
+	// Groups of instances of one class that are big only together
+	classIDs := make([]ID, 0, len(groups))
+	groupRetained := make(map[ID]int64)
+	for class, nodes := range groups {
+		for _, node := range nodes {
+			groupRetained[class] += dom.retained[node]
+		}
+		if len(nodes) > 1 && groupRetained[class] >= threshold {
+			classIDs = append(classIDs, class)
+		}
+	}
+	sort.Slice(classIDs, func(i, j int) bool {
+		return groupRetained[classIDs[i]] > groupRetained[classIDs[j]]
+	})
+
+	for _, class := range classIDs {
+		nodes := groups[class]
+		suspects++
+		result.Body = append(result.Body, fmt.Sprintf("%d. %d instances of %s retain %d bytes (%.1f%%)\n",
+			suspects, len(nodes), g.className(class), groupRetained[class], percentOf(groupRetained[class], total)))
+		result.Body = append(result.Body, fmt.Sprintf("   Biggest instance: %s, retained %d bytes\n",
+			g.describeNode(nodes[0]), dom.retained[nodes[0]]))
+		result.Body = append(result.Body, g.explainSuspect(nodes[0])...)
+		result.Body = append(result.Body, "\n")
+	}
+
+	if suspects == 0 {
+		result.Body = append(result.Body, "No leak suspects found\n")
+	}
+	return result
+}
+
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
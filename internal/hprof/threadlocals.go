@@ -0,0 +1,186 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// threadLocalEntry is an entry of ThreadLocal.ThreadLocalMap of a thread.
+type threadLocalEntry struct {
+	thread      int32
+	threadName  string
+	inheritable bool
+	key         int32 // ThreadLocal object, -1 when the weak key is cleared
+	value       int32
+}
+
+// stale entries lost their ThreadLocal but keep the value until the map is expunged.
+func (e threadLocalEntry) stale() bool {
+	return e.key < 0
+}
+
+// threadLocalEntries reads both ThreadLocalMap tables of a thread. Entries extend
+// WeakReference, the referent is the ThreadLocal and the value is held strongly.
+func (g *heapGraph) threadLocalEntries(thread InstanceDump) []threadLocalEntry {
+	node, ok := g.index[thread.ID]
+	if !ok {
+		return nil
+	}
+	fields := g.decodeFields(thread)
+	name, _ := g.threadName(fields)
+
+	var entries []threadLocalEntry
+	for _, mapField := range []string{"threadLocals", "inheritableThreadLocals"} {
+		mapFields, ok := g.instanceFields(refField(fields, mapField))
+		if !ok {
+			continue
+		}
+		for _, entryID := range g.arrayElements(mapFields, "table") {
+			if entryID == 0 {
+				continue
+			}
+			entryFields, ok := g.instanceFields(entryID)
+			if !ok {
+				continue
+			}
+			value, ok := g.index[refField(entryFields, "value")]
+			if !ok {
+				continue
+			}
+			key, ok := g.index[refField(entryFields, "referent")]
+			if !ok {
+				key = -1
+			}
+			entries = append(entries, threadLocalEntry{
+				thread:      node,
+				threadName:  name,
+				inheritable: mapField == "inheritableThreadLocals",
+				key:         key,
+				value:       value,
+			})
+		}
+	}
+	return entries
+}
+
+// threadLocalClass sums thread local values of one class.
+type threadLocalClass struct {
+	name     string
+	entries  int64
+	stale    int64
+	threads  map[int32]bool
+	retained int64
+}
+
+// threadLocalClasses groups entries by value class, classes retaining most come first.
+func (g *heapGraph) threadLocalClasses(entries []threadLocalEntry, retained []int64) []*threadLocalClass {
+	byClass := make(map[string]*threadLocalClass)
+	for _, e := range entries {
+		name := g.nodeClassName(e.value)
+		stats, ok := byClass[name]
+		if !ok {
+			stats = &threadLocalClass{name: name, threads: make(map[int32]bool)}
+			byClass[name] = stats
+		}
+		stats.entries++
+		stats.threads[e.thread] = true
+		stats.retained += retained[e.value]
+		if e.stale() {
+			stats.stale++
+		}
+	}
+
+	classes := make([]*threadLocalClass, 0, len(byClass))
+	for _, stats := range byClass {
+		classes = append(classes, stats)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].retained != classes[j].retained {
+			return classes[i].retained > classes[j].retained
+		}
+		return classes[i].name < classes[j].name
+	})
+	return classes
+}
+
+// sortThreadLocalEntries puts stale entries first, they are leaks regardless of size,
+// then entries retaining most.
+func sortThreadLocalEntries(entries []threadLocalEntry, retained []int64) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].stale() != entries[j].stale() {
+			return entries[i].stale()
+		}
+		if retained[entries[i].value] != retained[entries[j].value] {
+			return retained[entries[i].value] > retained[entries[j].value]
+		}
+		return entries[i].value < entries[j].value
+	})
+}
+
+// AnalyzeThreadLocals lists values of thread local maps of all threads, stale entries whose
+// ThreadLocal is gone and values retaining large graphs, grouped by value class.
+func AnalyzeThreadLocals(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nThread local values (top %d)\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	var entries []threadLocalEntry
+	err = forEachInstance(g.classIDsExtending("java.lang.Thread"), func(thread InstanceDump) {
+		entries = append(entries, g.threadLocalEntries(thread)...)
+	})
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading threads: %v\n", err))
+		return result
+	}
+	if len(entries) == 0 {
+		result.Body = append(result.Body, "No thread local values found\n")
+		return result
+	}
+	dom := g.dominators()
+
+	var stale, staleRetained, totalRetained int64
+	for _, e := range entries {
+		totalRetained += dom.retained[e.value]
+		if e.stale() {
+			stale++
+			staleRetained += dom.retained[e.value]
+		}
+	}
+	result.Body = append(result.Body, fmt.Sprintf("Entries: %d, Retained by values: %d bytes, Stale entries: %d, Retained by stale values: %d bytes\n",
+		len(entries), totalRetained, stale, staleRetained))
+
+	result.Body = append(result.Body, "\nValues by class:\n")
+	for i, stats := range g.threadLocalClasses(entries, dom.retained) {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Entries: %d, Stale: %d, Threads: %d, Retained: %d bytes\n",
+			i+1, stats.name, stats.entries, stats.stale, len(stats.threads), stats.retained))
+	}
+
+	sortThreadLocalEntries(entries, dom.retained)
+	result.Body = append(result.Body, "\nStale and largest entries:\n")
+	for i, e := range entries {
+		if i == max {
+			break
+		}
+		key := "<cleared, stale entry>"
+		if !e.stale() {
+			key = g.describeNode(e.key)
+		}
+		inheritable := ""
+		if e.inheritable {
+			inheritable = ", inheritable"
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. Thread %q %s%s\n", i+1, e.threadName, g.describeNode(e.thread), inheritable))
+		result.Body = append(result.Body, fmt.Sprintf("   Key: %s\n", key))
+		result.Body = append(result.Body, fmt.Sprintf("   Value: %s, Retained: %d bytes\n", g.describeNode(e.value), dom.retained[e.value]))
+	}
+	return result
+}
@@ -0,0 +1,290 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+// JVMTI thread state bits stored in java.lang.Thread.threadStatus
+const (
+	threadStateAlive          = 0x0001
+	threadStateTerminated     = 0x0002
+	threadStateRunnable       = 0x0004
+	threadStateWaitingForever = 0x0010
+	threadStateWaitingTimeout = 0x0020
+	threadStateBlocked        = 0x0400
+)
+
+// threadStateName converts threadStatus the same way as jdk.internal.misc.VM.toThreadState.
+func threadStateName(status int64) string {
+	switch {
+	case status&threadStateRunnable != 0:
+		return "RUNNABLE"
+	case status&threadStateBlocked != 0:
+		return "BLOCKED"
+	case status&threadStateWaitingForever != 0:
+		return "WAITING"
+	case status&threadStateWaitingTimeout != 0:
+		return "TIMED_WAITING"
+	case status&threadStateTerminated != 0:
+		return "TERMINATED"
+	case status&threadStateAlive == 0:
+		return "NEW"
+	}
+	return "RUNNABLE"
+}
+
+// threadInfo describes a thread found in RootThreadObject.
+type threadInfo struct {
+	node        int32
+	serial      int32
+	stackSerial int32
+	name        string
+	state       string
+	daemon      bool
+	locals      map[int32][]int32 // frame number -> objects held by local variables
+	retained    int64             // thread object together with its locals
+}
+
+// stackFrameLine is a frame of a stack trace with resolved names.
+type stackFrameLine struct {
+	Index     int32  `gorm:"column:idx"`
+	Method    string `gorm:"column:method"`
+	ClassName string `gorm:"column:class_name"`
+	Source    string `gorm:"column:source"`
+	Line      int32  `gorm:"column:line"`
+}
+
+func (f stackFrameLine) String() string {
+	location := f.Source
+	switch {
+	case f.Line == -3:
+		location = "Native Method"
+	case f.Line == -2:
+		location = "Compiled Code"
+	case location == "":
+		location = "Unknown Source"
+	case f.Line > 0:
+		location = fmt.Sprintf("%s:%d", f.Source, f.Line)
+	}
+	return fmt.Sprintf("at %s.%s(%s)", f.ClassName, f.Method, location)
+}
+
+func loadStackTrace(stackSerial int32) ([]stackFrameLine, error) {
+	var frames []stackFrameLine
+	query := `
+		SELECT
+			f."IndexInStackTrace" as idx,
+			COALESCE(convert_from(m."Bytes", 'UTF8'), '?') as method,
+			COALESCE(REPLACE(convert_from(c."Bytes", 'UTF8'), '/', '.'), '?') as class_name,
+			COALESCE(convert_from(src."Bytes", 'UTF8'), '') as source,
+			f."Flag" as line
+		FROM "StackFrame" f
+		LEFT JOIN "StringInUTF8" m ON f."MethodNameStringID" = m."StringID"
+		LEFT JOIN "LoadClass" lc ON f."ClassSerialNumber" = lc."ClassSerialNumber"
+		LEFT JOIN "StringInUTF8" c ON lc."ClassNameStringID" = c."StringID"
+		LEFT JOIN "StringInUTF8" src ON f."SourceFileNameStringID" = src."StringID"
+		WHERE f."StackTraceSerialNumber" = ?
+		ORDER BY f."IndexInStackTrace"
+	`
+	if err := GetDB().Raw(query, stackSerial).Scan(&frames).Error; err != nil {
+		return nil, fmt.Errorf("error getting stack trace %d: %w", stackSerial, err)
+	}
+	return frames, nil
+}
+
+// threadName decodes java.lang.Thread.name, which is a String in modern JDKs and char[] in old ones.
+func (g *heapGraph) threadName(fields []FieldValue) (string, bool) {
+	f, ok := findField(fields, "name")
+	if !ok {
+		return "", false
+	}
+	node, ok := g.index[f.asID()]
+	if !ok {
+		return "", false
+	}
+	if g.isStringNode(node) {
+		return g.stringValue(node)
+	}
+	if g.kinds[node] == KindPrimitiveArray && g.primTypes[node] == Char {
+		arrays, err := loadPrimitiveArrays([]ID{g.ids[node]})
+		if err != nil {
+			return "", false
+		}
+		if data, ok := arrays[g.ids[node]]; ok {
+			return decodeStringValue(data, Char, -1), true
+		}
+	}
+	return "", false
+}
+
+// threadState reads threadStatus and daemon, since JDK 19 they live in Thread.holder.
+func (g *heapGraph) threadState(fields []FieldValue) (string, bool) {
+	if holder, ok := findField(fields, "holder"); ok && holder.Type == Object {
+		if instance, ok := loadInstance(holder.asID()); ok {
+			fields = g.decodeFields(instance)
+		}
+	}
+	state := "unknown"
+	if status, ok := findField(fields, "threadStatus"); ok {
+		state = threadStateName(status.asInt())
+	}
+	daemon, ok := findField(fields, "daemon")
+	return state, ok && daemon.asInt() != 0
+}
+
+// loadThreads collects threads with names, states and objects held by their frames.
+func (g *heapGraph) loadThreads() ([]*threadInfo, error) {
+	var threadRoots []RootThreadObject
+	if err := GetDB().Find(&threadRoots).Error; err != nil {
+		return nil, fmt.Errorf("error getting thread objects: %w", err)
+	}
+
+	// StartThread keeps names of threads when the Thread object can not be decoded
+	type startedThread struct {
+		Serial int32  `gorm:"column:serial"`
+		Name   string `gorm:"column:name"`
+	}
+	var started []startedThread
+	query := `
+		SELECT
+			st."ThreadSerialNumber" as serial,
+			COALESCE(convert_from(s."Bytes", 'UTF8'), '') as name
+		FROM "StartThread" st
+		LEFT JOIN "StringInUTF8" s ON st."ThreadNameStringID" = s."StringID"
+	`
+	if err := GetDB().Raw(query).Scan(&started).Error; err != nil {
+		return nil, fmt.Errorf("error getting started threads: %w", err)
+	}
+	startedNames := make(map[int32]string)
+	for _, st := range started {
+		if st.Name != "" {
+			startedNames[st.Serial] = st.Name
+		}
+	}
+
+	threads := make([]*threadInfo, 0, len(threadRoots))
+	bySerial := make(map[int32]*threadInfo)
+	for _, root := range threadRoots {
+		node, ok := g.index[root.ID]
+		if !ok {
+			continue
+		}
+		thread := &threadInfo{
+			node:        node,
+			serial:      root.ThreadSerialNumber,
+			stackSerial: root.StackTraceSerialNumber,
+			name:        startedNames[root.ThreadSerialNumber],
+			state:       "unknown",
+			locals:      make(map[int32][]int32),
+		}
+		if instance, ok := loadInstance(root.ID); ok {
+			fields := g.decodeFields(instance)
+			if name, ok := g.threadName(fields); ok {
+				thread.name = name
+			}
+			thread.state, thread.daemon = g.threadState(fields)
+		}
+		threads = append(threads, thread)
+		bySerial[thread.serial] = thread
+	}
+
+	for _, root := range g.roots {
+		if root.Type != RootJavaFrameTag && root.Type != RootJNILocalTag {
+			continue
+		}
+		if thread, ok := bySerial[root.ThreadSerialNumber]; ok {
+			thread.locals[root.FrameNumber] = append(thread.locals[root.FrameNumber], root.Node)
+		}
+	}
+
+	dom := g.dominators()
+	for _, thread := range threads {
+		held := map[int32]bool{thread.node: true}
+		for _, nodes := range thread.locals {
+			for _, node := range nodes {
+				held[node] = true
+			}
+			sort.Slice(nodes, func(i, j int) bool { return dom.retained[nodes[i]] > dom.retained[nodes[j]] })
+		}
+		thread.retained = g.retainedBySet(func(node int32) bool { return held[node] })
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].retained != threads[j].retained {
+			return threads[i].retained > threads[j].retained
+		}
+		return threads[i].serial < threads[j].serial
+	})
+	return threads, nil
+}
+
+// PrintThreads lists threads with name, state and stack, and under every frame
+// up to max objects held by its local variables with their retained sizes.
+func PrintThreads(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: "\n\nThreads by retained size\n",
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+	threads, err := g.loadThreads()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error loading threads: %v\n", err))
+		return result
+	}
+	if len(threads) == 0 {
+		result.Body = append(result.Body, "No threads found\n")
+		return result
+	}
+	dom := g.dominators()
+
+	formatLocals := func(nodes []int32) []string {
+		lines := make([]string, 0, len(nodes))
+		for i, node := range nodes {
+			if i == max {
+				lines = append(lines, fmt.Sprintf("         ... %d more\n", len(nodes)-max))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("         local %s, Retained: %d\n", g.describeNode(node), dom.retained[node]))
+		}
+		return lines
+	}
+
+	for i, thread := range threads {
+		daemon := ""
+		if thread.daemon {
+			daemon = " daemon"
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %q%s %s, State: %s, Retained: %d bytes\n",
+			i+1, thread.name, daemon, g.describeNode(thread.node), thread.state, thread.retained))
+
+		frames, err := loadStackTrace(thread.stackSerial)
+		if err != nil {
+			result.Body = append(result.Body, fmt.Sprintf("   Error: %v\n", err))
+		}
+		printed := make(map[int32]bool)
+		for _, frame := range frames {
+			result.Body = append(result.Body, fmt.Sprintf("      %s\n", frame))
+			result.Body = append(result.Body, formatLocals(thread.locals[frame.Index])...)
+			printed[frame.Index] = true
+		}
+
+		// Locals of frames missing from the stack trace
+		var rest []int32
+		for frame := range thread.locals {
+			if !printed[frame] {
+				rest = append(rest, frame)
+			}
+		}
+		sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+		for _, frame := range rest {
+			result.Body = append(result.Body, fmt.Sprintf("      frame %d\n", frame))
+			result.Body = append(result.Body, formatLocals(thread.locals[frame])...)
+		}
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package hprof
+
+import (
+	"fmt"
+	"sort"
+)
+
+type unreachableStats struct {
+	count int64
+	size  int64
+}
+
+// unreachableByClass counts objects not marked as reachable per class name.
+func (g *heapGraph) unreachableByClass(reachable []bool) map[string]*unreachableStats {
+	stats := make(map[string]*unreachableStats)
+	for node := range g.ids {
+		if reachable[node] {
+			continue
+		}
+		name := g.nodeClassName(int32(node))
+		s, ok := stats[name]
+		if !ok {
+			s = &unreachableStats{}
+			stats[name] = s
+		}
+		s.count++
+		s.size += g.sizes[node]
+	}
+	return stats
+}
+
+// withoutUnreachable returns a copy of the graph containing only objects reachable from GC roots.
+// Statistics of the dropped objects are kept in the excluded field.
+func (g *heapGraph) withoutUnreachable() *heapGraph {
+	reachable := g.reachable(nil)
+	compact := newHeapGraph()
+	compact.model = g.model
+	compact.classNames = g.classNames
+	compact.fieldNames = g.fieldNames
+	compact.superOf = g.superOf
+	compact.loaderOf = g.loaderOf
+	compact.layouts = g.layouts
+	compact.refKinds = g.refKinds
+	compact.excluded = g.unreachableByClass(reachable)
+
+	newNode := make([]int32, len(g.ids))
+	for node := 1; node < len(g.ids); node++ {
+		if !reachable[node] {
+			newNode[node] = -1
+			continue
+		}
+		n := compact.addNode(g.ids[node], g.kinds[node], g.classes[node], g.sizes[node])
+		compact.primTypes[n] = g.primTypes[node]
+		compact.lengths[n] = g.lengths[node]
+		newNode[node] = n
+	}
+	for from, targets := range g.out {
+		if !reachable[from] {
+			continue
+		}
+		// Targets of a reachable object are reachable as well
+		out := make([]int32, 0, len(targets))
+		for _, to := range targets {
+			out = append(out, newNode[to])
+		}
+		compact.out[newNode[from]] = out
+	}
+	for _, root := range g.roots {
+		root.Node = newNode[root.Node]
+		compact.roots = append(compact.roots, root)
+	}
+	for ref, referent := range g.referents {
+		if reachable[ref] && reachable[referent] {
+			compact.referents[newNode[ref]] = newNode[referent]
+		}
+	}
+	return compact
+}
+
+// reachableFilter returns a check of object IDs for analyses reading objects from the database
+// directly, so they skip garbage like the graph does. It is nil unless GraphOptions.ExcludeUnreachable is set.
+func reachableFilter() (func(ID) bool, error) {
+	if !graphOptions.ExcludeUnreachable {
+		return nil, nil
+	}
+	g, err := getHeapGraph()
+	if err != nil {
+		return nil, err
+	}
+	// The graph keeps only reachable objects
+	return func(id ID) bool {
+		_, ok := g.index[id]
+		return ok
+	}, nil
+}
+
+// AnalyzeUnreachable reports objects that are not reachable from any GC root by class.
+func AnalyzeUnreachable(max int) (result AnalyzeResult) {
+	result = AnalyzeResult{
+		Header: fmt.Sprintf("\n\nTop %d classes of unreachable objects\n", max),
+		Body:   make([]string, 0),
+	}
+
+	g, err := getHeapGraph()
+	if err != nil {
+		result.Body = append(result.Body, fmt.Sprintf("Error building heap graph: %v\n", err))
+		return result
+	}
+
+	stats := g.excluded
+	if stats == nil {
+		stats = g.unreachableByClass(g.reachable(nil))
+	} else {
+		result.Body = append(result.Body, "Unreachable objects are excluded from all graph analyses\n")
+	}
+
+	type classStats struct {
+		name string
+		unreachableStats
+	}
+	classes := make([]classStats, 0, len(stats))
+	var total unreachableStats
+	for name, s := range stats {
+		classes = append(classes, classStats{name, *s})
+		total.count += s.count
+		total.size += s.size
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].size != classes[j].size {
+			return classes[i].size > classes[j].size
+		}
+		return classes[i].name < classes[j].name
+	})
+
+	result.Body = append(result.Body, fmt.Sprintf("Unreachable objects: %d, size: %d bytes\n", total.count, total.size))
+	for i, c := range classes {
+		if i == max {
+			break
+		}
+		result.Body = append(result.Body, fmt.Sprintf("%d. %s: Count: %d, Size: %d\n", i+1, c.name, c.count, c.size))
+	}
+	return result
+}
@@ -0,0 +1,349 @@
+package hprof
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// collectionEntry is a logical element of a collection. Lists and sets keep elements in value.
+type collectionEntry struct {
+	key   ID
+	value ID
+}
+
+// collectionView is the content of a collection as the program sees it,
+// without internal nodes, buckets and unused slots.
+type collectionView struct {
+	kind    string
+	isMap   bool
+	size    int64
+	entries []collectionEntry
+}
+
+// viewDecoder walks the internal structure of a collection and returns up to limit entries,
+// all of them when limit is negative.
+type viewDecoder func(g *heapGraph, fields []FieldValue, limit int) []collectionEntry
+
+// viewDecoders are keyed by the class name, subclasses use the decoder of the nearest superclass.
+var viewDecoders = map[string]viewDecoder{
+	"java.util.ArrayList":                       arrayListEntries("size"),
+	"java.util.Vector":                          arrayListEntries("elementCount"),
+	"java.util.concurrent.CopyOnWriteArrayList": copyOnWriteEntries,
+	"java.util.ArrayDeque":                      arrayDequeEntries,
+	"java.util.LinkedList":                      linkedListEntries,
+	"java.util.HashMap":                         hashMapEntries("value"),
+	"java.util.Hashtable":                       hashMapEntries("value"),
+	"java.util.LinkedHashMap":                   linkedHashMapEntries,
+	"java.util.concurrent.ConcurrentHashMap":    hashMapEntries("val"),
+	"java.util.TreeMap":                         treeMapEntries,
+}
+
+// instanceFields loads and decodes fields of an instance.
+func (g *heapGraph) instanceFields(id ID) ([]FieldValue, bool) {
+	instance, ok := loadInstance(id)
+	if !ok {
+		return nil, false
+	}
+	return g.decodeFields(instance), true
+}
+
+// refField returns the object referenced by the field or 0.
+func refField(fields []FieldValue, name string) ID {
+	f, ok := findField(fields, name)
+	if !ok {
+		return 0
+	}
+	return f.asID()
+}
+
+// loadObjectArray returns elements from offset to end of an object array, null elements are 0.
+var loadObjectArray = func(id ID, offset, end int) ([]ID, error) {
+	var elements []ObjectArrayElement
+	if err := GetDB().Where("\"ObjectArrayDumpID\" = ? AND \"Index\" >= ? AND \"Index\" < ?", id, offset, end).
+		Find(&elements).Error; err != nil {
+		return nil, fmt.Errorf("error getting array elements: %w", err)
+	}
+	// Null elements may be left out of the table
+	values := make([]ID, end-offset)
+	for _, element := range elements {
+		values[int(element.Index)-offset] = element.InstanceDumpID
+	}
+	return values, nil
+}
+
+// arrayElements returns all elements of the object array referenced by the field.
+func (g *heapGraph) arrayElements(fields []FieldValue, name string) []ID {
+	node, ok := g.index[refField(fields, name)]
+	if !ok || g.kinds[node] != KindObjectArray {
+		return nil
+	}
+	values, err := loadObjectArray(g.ids[node], 0, int(g.lengths[node]))
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
+// full reports whether enough entries are collected.
+func full(entries []collectionEntry, limit int) bool {
+	return limit >= 0 && len(entries) >= limit
+}
+
+func arrayListEntries(sizeField string) viewDecoder {
+	return func(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+		size := 0
+		if f, ok := findField(fields, sizeField); ok {
+			size = int(f.asInt())
+		}
+		var entries []collectionEntry
+		for i, element := range g.arrayElements(fields, "elementData") {
+			if i >= size || full(entries, limit) {
+				break
+			}
+			entries = append(entries, collectionEntry{value: element})
+		}
+		return entries
+	}
+}
+
+// copyOnWriteEntries returns the whole array, it is replaced on every modification.
+func copyOnWriteEntries(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+	var entries []collectionEntry
+	for _, element := range g.arrayElements(fields, "array") {
+		if full(entries, limit) {
+			break
+		}
+		entries = append(entries, collectionEntry{value: element})
+	}
+	return entries
+}
+
+// ringIndexes lists slots of a circular buffer from head up to tail.
+func ringIndexes(head, tail, length int) []int {
+	if length <= 0 || head < 0 || head >= length {
+		return nil
+	}
+	var indexes []int
+	for i := head; i != tail; i = (i + 1) % length {
+		indexes = append(indexes, i)
+		if len(indexes) == length {
+			break
+		}
+	}
+	return indexes
+}
+
+func arrayDequeEntries(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+	elements := g.arrayElements(fields, "elements")
+	head, _ := findField(fields, "head")
+	tail, _ := findField(fields, "tail")
+	var entries []collectionEntry
+	for _, i := range ringIndexes(int(head.asInt()), int(tail.asInt()), len(elements)) {
+		if full(entries, limit) {
+			break
+		}
+		if elements[i] != 0 {
+			entries = append(entries, collectionEntry{value: elements[i]})
+		}
+	}
+	return entries
+}
+
+// chainEntries follows next links starting from the first node, every node yields one entry.
+func (g *heapGraph) chainEntries(first ID, next string, entry func([]FieldValue) (collectionEntry, bool), limit int) []collectionEntry {
+	var entries []collectionEntry
+	visited := make(map[ID]bool)
+	for current := first; current != 0 && !visited[current] && !full(entries, limit); {
+		visited[current] = true
+		fields, ok := g.instanceFields(current)
+		if !ok {
+			break
+		}
+		if e, ok := entry(fields); ok {
+			entries = append(entries, e)
+		}
+		current = refField(fields, next)
+	}
+	return entries
+}
+
+func linkedListEntries(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+	return g.chainEntries(refField(fields, "first"), "next", func(node []FieldValue) (collectionEntry, bool) {
+		return collectionEntry{value: refField(node, "item")}, true
+	}, limit)
+}
+
+// hashMapEntries walks buckets of the table in order. Tree bins of HashMap keep the next chain of
+// their nodes, ConcurrentHashMap.TreeBin points to the chain with "first".
+func hashMapEntries(valueField string) viewDecoder {
+	return func(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+		var entries []collectionEntry
+		for _, bucket := range g.arrayElements(fields, "table") {
+			if full(entries, limit) {
+				break
+			}
+			if bucket == 0 {
+				continue
+			}
+			if bin, ok := g.instanceFields(bucket); ok {
+				if first, ok := findField(bin, "first"); ok {
+					bucket = first.asID()
+				}
+			}
+			entries = append(entries, g.chainEntries(bucket, "next", func(node []FieldValue) (collectionEntry, bool) {
+				// ConcurrentHashMap.ForwardingNode moves the bucket to nextTable during resize
+				if _, ok := findField(node, "nextTable"); ok {
+					return collectionEntry{}, false
+				}
+				return collectionEntry{key: refField(node, "key"), value: refField(node, valueField)}, true
+			}, limit-len(entries))...)
+		}
+		return entries
+	}
+}
+
+// linkedHashMapEntries returns entries in insertion or access order.
+func linkedHashMapEntries(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+	return g.chainEntries(refField(fields, "head"), "after", func(node []FieldValue) (collectionEntry, bool) {
+		return collectionEntry{key: refField(node, "key"), value: refField(node, "value")}, true
+	}, limit)
+}
+
+// treeMapEntries walks the red-black tree in key order.
+func treeMapEntries(g *heapGraph, fields []FieldValue, limit int) []collectionEntry {
+	var entries []collectionEntry
+	visited := make(map[ID]bool)
+	var stack [][]FieldValue
+	current := refField(fields, "root")
+	for (current != 0 || len(stack) > 0) && !full(entries, limit) {
+		for current != 0 && !visited[current] {
+			visited[current] = true
+			node, ok := g.instanceFields(current)
+			if !ok {
+				break
+			}
+			stack = append(stack, node)
+			current = refField(node, "left")
+		}
+		if len(stack) == 0 {
+			break
+		}
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		entries = append(entries, collectionEntry{key: refField(node, "key"), value: refField(node, "value")})
+		current = refField(node, "right")
+	}
+	return entries
+}
+
+// collectionView decodes up to limit logical entries of a collection instance.
+// Sets are shown as keys of the map they wrap.
+func (g *heapGraph) collectionView(instance InstanceDump, limit int) (collectionView, bool) {
+	if spec, ok := g.collectionSpecOf(instance.ClassObjectID); ok {
+		if field, ok := collectionDelegates[spec.kind]; ok {
+			inner, ok := loadInstance(refField(g.decodeFields(instance), field))
+			if !ok {
+				return collectionView{}, false
+			}
+			view, ok := g.collectionView(inner, limit)
+			view.kind = g.className(instance.ClassObjectID)
+			if view.isMap {
+				for i, e := range view.entries {
+					view.entries[i] = collectionEntry{value: e.key}
+				}
+				view.isMap = false
+			}
+			return view, ok
+		}
+	}
+
+	var decode viewDecoder
+	for current := instance.ClassObjectID; current != 0 && decode == nil; current = g.superOf[current] {
+		decode = viewDecoders[g.classNames[current]]
+	}
+	if decode == nil {
+		return collectionView{}, false
+	}
+	view := collectionView{kind: g.className(instance.ClassObjectID), size: -1}
+	if info, ok := g.decodeCollection(instance); ok {
+		view.isMap = info.isMap
+		view.size = info.size
+	}
+	view.entries = decode(g, g.decodeFields(instance), limit)
+	return view, true
+}
+
+// formatElement shows an element of a collection, boxed primitives are followed by their value.
+func (g *heapGraph) formatElement(id ID) string {
+	description := g.formatReference(id)
+	if node, ok := g.node(id); ok {
+		if box, ok := g.boxTypeOf(node); ok {
+			if fields, ok := g.instanceFields(id); ok {
+				if value, ok := findField(fields, "value"); ok {
+					description += " " + formatPrimitive(box.primitive, value.Value)
+				}
+			}
+		}
+	}
+	return description
+}
+
+// inspectCollection prints entries from offset to offset+limit of a collection.
+func (g *heapGraph) inspectCollection(view collectionView, offset int) []string {
+	if offset < 0 {
+		offset = 0
+	}
+	size := ""
+	if view.size >= 0 {
+		size = fmt.Sprintf(", size %d", view.size)
+	}
+	lines := []string{fmt.Sprintf("Contents of %s%s:\n", view.kind, size)}
+	if offset >= len(view.entries) {
+		return append(lines, fmt.Sprintf("   no entries from index %d\n", offset))
+	}
+	for i := offset; i < len(view.entries); i++ {
+		e := view.entries[i]
+		if view.isMap {
+			lines = append(lines, fmt.Sprintf("   [%d] %s => %s\n", i, g.formatElement(e.key), g.formatElement(e.value)))
+		} else {
+			lines = append(lines, fmt.Sprintf("   [%d] %s\n", i, g.formatElement(e.value)))
+		}
+	}
+	return lines
+}
+
+// ExportCollection writes all entries of a collection as CSV with object IDs and descriptions
+// of keys and values. Key columns are empty for lists and sets.
+func ExportCollection(objectID ID, w io.Writer) error {
+	g, err := getHeapGraph()
+	if err != nil {
+		return fmt.Errorf("error building heap graph: %w", err)
+	}
+	instance, ok := loadInstance(objectID)
+	if !ok {
+		return fmt.Errorf("instance %d not found", objectID)
+	}
+	view, ok := g.collectionView(instance, -1)
+	if !ok {
+		return fmt.Errorf("%s is not a supported collection", g.formatReference(objectID))
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"index", "key_id", "key", "value_id", "value"}); err != nil {
+		return err
+	}
+	for i, e := range view.entries {
+		record := []string{strconv.Itoa(i), "", "", strconv.FormatInt(int64(e.value), 10), g.formatElement(e.value)}
+		if view.isMap {
+			record[1] = strconv.FormatInt(int64(e.key), 10)
+			record[2] = g.formatElement(e.key)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}